@@ -11,8 +11,8 @@
 //
 // Tests are grouped using struct methods. Each test in a test group needs to
 // be defined as a struct method with `SubTest` prefix. To run a group of
-// tests, have the test group struct implement `GTest` interface, then passe it
-// to `RunSubTests` call.
+// tests, pass the test group struct to `RunSubTests` call. Hooks from `GTest`
+// interface are optional, a test group only needs to define the ones it uses.
 //
 // Example of test grouping:
 //
@@ -27,8 +27,9 @@
 //    // Setup and Teardown are invoked per test group run
 //    func (s *SampleTests) Setup(t *testing.T)      {}
 //    func (s *SampleTests) Teardown(t *testing.T)   {}
-//    // BeforeEach and AfterEach are invoked per test run
-//    func (s *SampleTests) BeforeEach(t *testing.T) {}
+//    // BeforeEach and AfterEach are invoked per test run, hooks can
+//    // optionally return error
+//    func (s *SampleTests) BeforeEach(t *testing.T) error { return nil }
 //    func (s *SampleTests) AfterEach(t *testing.T)  {}
 //
 //    func (s *SampleTests) SubTestCompare(t *testing.T) {
@@ -105,4 +106,187 @@
 //
 // Note that you can pass fixtures to fixture's Construct method as well, making it possible
 // to build fixtures using other fixtures in a nested fashion.
+//
+// Simple fixtures can be registered as a function with RegisterFixtureFunc.
+// The function takes the same parameters as Construct, and returns a cleanup
+// function in place of destruct context:
+//
+//    gtest.MustRegisterFixtureFunc("WorkDir", func(t *testing.T, fixtures struct{}) (string, func()) {
+//      dir, err := ioutil.TempDir("", "gtest-fixture")
+//      assert.NoError(t, err)
+//      return dir, func() { os.RemoveAll(dir) }
+//    }, gtest.ScopeSubTest)
+//
+// Construct can optionally return an error as third value, and Destruct can
+// optionally return an error. Construct errors fail the test before it runs
+// and are reported with the chain of fixtures that led to them, e.g.
+// "MockComment -> MockUser -> UserId: connection refused".
+//
+// Both Construct and Destruct can optionally take a context.Context as first
+// parameter. The context is bounded by the test deadline and cancelled once
+// the fixture's scope ends. Use WithConstructTimeout option when registering
+// a fixture to limit how long its Construct can take, the timeout is enforced
+// even if Construct doesn't watch the context.
+//
+// Fixture scope controls how long a fixture value is cached: ScopeCall,
+// ScopeSubTest, ScopeGroup and ScopeSession. Construct of ScopeGroup and
+// ScopeSession fixtures is called with *testing.T of the test referencing the
+// fixture first, so these fixtures should release their resources in Destruct
+// rather than through t.TempDir or t.Cleanup. ScopeSession fixtures are
+// destructed by Main, which needs to be called from TestMain:
+//
+//    func TestMain(m *testing.M) {
+//      gtest.Main(m)
+//    }
+//
+// Fixtures registered with RegisterFixture live in DefaultRegistry. Use
+// NewRegistry or DefaultRegistry.Clone to build an isolated set of fixtures,
+// and pass it to RunSubTests with WithRegistry option.
+//
+// Fixture tags accept options after the fixture name. Fields tagged with
+// optional are left with zero value if the fixture is not registered, default
+// sets the value used instead, e.g. `fixture:"Port,default=8080"`. Other
+// key=value options are passed to Construct through *Request, which it can
+// take between *testing.T and fixtures struct. Fixture values are cached
+// separately for each set of arguments:
+//
+//    func (s *UserFixture) Construct(t *testing.T, req *gtest.Request, fixtures struct{}) (*User, interface{}) {
+//      return &User{Role: req.Args["role"]}, nil
+//    }
+//
+//    func (s *SampleTests) SubTestAdmin(t *testing.T, fixtures struct {
+//      Admin *User `fixture:"User,role=admin"`
+//    }) {}
+//
+// Request also describes who is asking for the fixture: the test group,
+// SubTest method and field requesting it, fixture's scope and selected
+// parameter. Request.AddFinalizer schedules a function to be called after the
+// fixture is destructed.
+//
+// Fixtures registered with WithTypeProvider option provide values by type.
+// Fields of fixtures structs without fixture tag, and fields tagged without
+// fixture name, e.g. `fixture:""`, are injected with the provider of their
+// type. Fields matching more than one provider are reported as ambiguous:
+//
+//    gtest.MustRegisterFixture("MockApiServer", &MockApiServerFixture{}, gtest.ScopeGroup, gtest.WithTypeProvider())
+//
+//    func (s *SampleTests) SubTestApi(t *testing.T, fixtures struct {
+//      Server *httptest.Server
+//    }) {}
+//
+// Fixtures can be parametrized with WithParams option, or by implementing
+// Params() []interface{}. Each SubTest using a parametrized fixture, directly
+// or through other fixtures, runs once per parameter, e.g. "Store/sqlite" and
+// "Store/memory". Using several parametrized fixtures runs the SubTest once
+// per combination of their parameters. Construct gets the current parameter
+// with Param:
+//
+//    gtest.MustRegisterFixtureFunc("Backend", func(t *testing.T, fixtures struct{}) (string, func()) {
+//      return gtest.Param(t).(string), nil
+//    }, gtest.ScopeSubTest, gtest.WithParams("sqlite", "memory"))
+//
+// Fixtures registered with WithAutouse option are constructed for every
+// SubTest run against their registry, even if the SubTest doesn't reference
+// them. A test group can list additional autouse fixtures with AutoFixtures
+// method:
+//
+//    func (s *SampleTests) AutoFixtures() []string {
+//      return []string{"LeakCheck"}
+//    }
+//
+// Fixtures implementing Fixture interface can be registered with Register, or
+// MustRegister panicking on failure, which return a typed handle to fetch
+// fixture value from tests and other fixtures:
+//
+//    type TempDirFixture struct{}
+//
+//    func (s TempDirFixture) Construct(t *testing.T) (string, string, error) {
+//      dir, err := ioutil.TempDir("", "gtest-fixture")
+//      return dir, dir, err
+//    }
+//
+//    func (s TempDirFixture) Destruct(t *testing.T, dir string) error {
+//      return os.RemoveAll(dir)
+//    }
+//
+//    var tempDir = gtest.MustRegister[string, string]("TempDir", TempDirFixture{}, gtest.ScopeSubTest)
+//
+//    func (s *SampleTests) SubTestTempDir(t *testing.T) {
+//      dir := tempDir.Get(t)
+//    }
+//
+// Fixtures only needed on some code paths can be requested on demand with
+// Use, or its typed variant UseAs. Values are cached and destructed the same
+// way as fixtures referenced in fixtures struct:
+//
+//    if needsServer {
+//      server := gtest.UseAs[*httptest.Server](t, "MockApiServer")
+//    }
+//
+// Alternatively, declare a field of SubTest, BeforeEach or AfterEach fixtures
+// struct with Lazy type. The fixture is constructed on first call to Get, and
+// only destructed if it has been constructed:
+//
+//    func (s *SampleTests) SubTestApi(t *testing.T, fixtures struct {
+//      Server gtest.Lazy[*httptest.Server] `fixture:"MockApiServer"`
+//    }) {}
+//
+// Hook methods can take a fixtures struct as second parameter as well. Setup
+// and Teardown share ScopeGroup fixture values with subtests, BeforeEach and
+// AfterEach share ScopeSubTest fixture values with the subtest they are called
+// for.
+//
+// Fields of a test group struct tagged with fixture tag are injected with
+// fixture values. Fields referencing ScopeGroup and ScopeSession fixtures are
+// injected before Setup, other fields before each BeforeEach. Fields are reset
+// to zero value once their scope ends:
+//
+//    type APITests struct {
+//      Server *httptest.Server `fixture:"MockApiServer"`
+//    }
+//
+// Test groups can be nested through methods or fields with Group prefix,
+// holding or returning a group struct or pointer to one with SubTest methods
+// or nested groups of its own. A nested group runs as a subtest named after
+// the method or field, with its own Setup and Teardown. Group methods are
+// called once Setup of the enclosing group has succeeded, so they can pass on
+// state set up by it. A nested group reuses ScopeGroup fixture values
+// constructed by enclosing groups, and BeforeEach and AfterEach of enclosing
+// groups wrap its own:
+//
+//    func (s *APITests) GroupUsers() interface{} {
+//      return &UserTests{client: s.client}
+//    }
+//
+// Table driven tests can be written by pairing a SubTest method with a Cases
+// method returning a slice of test cases. The SubTest runs once per case with
+// the case passed as its last parameter, subtests are named after case's
+// String method or Name field. Fixtures are resolved for each case:
+//
+//    func (s *SampleTests) CasesPrefix() []PrefixCase {
+//      return []PrefixCase{{Name: "Short", Input: "abc", Prefix: "a"}}
+//    }
+//
+//    func (s *SampleTests) SubTestPrefix(t *testing.T, fixtures struct {
+//      DirPath string `fixture:"WorkDir"`
+//    }, tc PrefixCase) {
+//      if !strings.HasPrefix(tc.Input, tc.Prefix) {
+//        t.FailNow()
+//      }
+//    }
+//
+// Pass WithParallel option to RunSubTests to run subtests of a group in
+// parallel. Concurrent requests for a group or session fixture share a single
+// Construct call, and calls on the same fixture instance are serialized.
+// Teardown is called once all parallel subtests have finished. Test group
+// fields can only reference ScopeGroup and ScopeSession fixtures in parallel
+// mode.
+//
+// RunSubTests checks the test group with Validate before running it, so
+// invalid SubTest signatures, unregistered fixtures and fixture dependency
+// cycles are all reported at once before Setup is called.
+//
+// Fixture dependency cycles are reported with the cycle path, e.g.
+// "A -> B -> A", instead of recursing forever. Registry.CheckCycles reports
+// all cycles among fixtures of a registry.
 package gtest
@@ -54,11 +54,6 @@ func init() {
 
 type SampleTests struct{}
 
-func (s *SampleTests) Setup(t *testing.T)      {}
-func (s *SampleTests) Teardown(t *testing.T)   {}
-func (s *SampleTests) BeforeEach(t *testing.T) {}
-func (s *SampleTests) AfterEach(t *testing.T)  {}
-
 func (s *SampleTests) SubTestCompare(t *testing.T) {
 	if 1 != 1 {
 		t.FailNow()
@@ -0,0 +1,31 @@
+package gtest
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"testing"
+)
+
+// helperTestEnv names the helper test run by RunHelperTest.
+const helperTestEnv = "GTEST_HELPER_TEST"
+
+// RunHelperTest runs test named name in a new process of the test binary, so
+// failures reported by gtest can be checked without failing the current test.
+// Returned error is an *exec.ExitError if the helper test failed.
+func RunHelperTest(t *testing.T, name string) (stdout string, stderr string, err error) {
+	cmd := exec.Command(os.Args[0], "-test.run=^"+name+"$", "-test.v")
+	cmd.Env = append(os.Environ(), helperTestEnv+"="+name)
+	var outBuf, errBuf bytes.Buffer
+	cmd.Stdout = &outBuf
+	cmd.Stderr = &errBuf
+	err = cmd.Run()
+	return outBuf.String(), errBuf.String(), err
+}
+
+// SkipUnlessHelper skips t unless it is run by RunHelperTest.
+func SkipUnlessHelper(t *testing.T) {
+	if os.Getenv(helperTestEnv) != t.Name() {
+		t.Skip("only run by RunHelperTest")
+	}
+}
@@ -0,0 +1,133 @@
+package gtest
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// Fixture is implemented by typed fixtures registered with Register. T is
+// the type of fixture value, C is the type of context passed from Construct
+// to Destruct.
+//
+// Typed fixtures fetch their dependencies by calling Get on other fixture
+// handles with the *testing.T passed to Construct.
+type Fixture[T any, C any] interface {
+	Construct(t *testing.T) (T, C, error)
+	Destruct(t *testing.T, ctx C) error
+}
+
+// typedFixture adapts Fixture to Construct and Destruct methods expected by
+// Registry.
+type typedFixture[T any, C any] struct {
+	f Fixture[T, C]
+}
+
+func (s *typedFixture[T, C]) Construct(t *testing.T, fixtures struct{}) (T, C, error) {
+	return s.f.Construct(t)
+}
+
+func (s *typedFixture[T, C]) Destruct(t *testing.T, ctx C) error {
+	return s.f.Destruct(t, ctx)
+}
+
+// Handle references a fixture registered with Register.
+type Handle[T any] struct {
+	name string
+}
+
+// Name returns name the fixture is registered under, it can be used to
+// reference the fixture in fixtures struct tags.
+func (h Handle[T]) Name() string {
+	return h.name
+}
+
+// Get returns fixture value for t, constructing it if needed. It can be
+// called from subtests and from Construct methods of other fixtures.
+func (h Handle[T]) Get(t *testing.T) T {
+	t.Helper()
+	return UseAs[T](t, h.name)
+}
+
+// UseAs is a typed variant of Use, it fails the test if fixture value is not
+// of type T.
+func UseAs[T any](t *testing.T, name string) T {
+	t.Helper()
+	val := Use(t, name)
+	v, ok := val.(T)
+	if !ok && val != nil {
+		t.Fatalf("Fixture '%s' has type %T, not %T", name, val, v)
+	}
+	return v
+}
+
+// Register a typed fixture in DefaultRegistry. Returned handle can be used to
+// fetch fixture value in tests.
+func Register[T any, C any](name string, f Fixture[T, C], scope FixtureScope, opts ...FixtureOption) (Handle[T], error) {
+	return RegisterIn[T, C](DefaultRegistry, name, f, scope, opts...)
+}
+
+// Register a typed fixture in DefaultRegistry, panic if registration failed.
+func MustRegister[T any, C any](name string, f Fixture[T, C], scope FixtureScope, opts ...FixtureOption) Handle[T] {
+	return MustRegisterIn[T, C](DefaultRegistry, name, f, scope, opts...)
+}
+
+// RegisterIn registers a typed fixture in reg.
+func RegisterIn[T any, C any](
+	reg *Registry, name string, f Fixture[T, C], scope FixtureScope, opts ...FixtureOption,
+) (Handle[T], error) {
+	if err := reg.Register(name, &typedFixture[T, C]{f: f}, scope, opts...); err != nil {
+		return Handle[T]{}, err
+	}
+	return Handle[T]{name: name}, nil
+}
+
+// MustRegisterIn registers a typed fixture in reg, panic if registration
+// failed.
+func MustRegisterIn[T any, C any](
+	reg *Registry, name string, f Fixture[T, C], scope FixtureScope, opts ...FixtureOption,
+) Handle[T] {
+	h, err := RegisterIn[T, C](reg, name, f, scope, opts...)
+	if err != nil {
+		panic(fmt.Sprintf("Failed to register fixture: %v", err))
+	}
+	return h
+}
+
+// Lazy is a fixtures struct field type deferring fixture construction until
+// the first call to Get. Fixtures that are never used by a test are not
+// constructed, nor destructed:
+//
+//    func (s *SampleTests) SubTestApi(t *testing.T, fixtures struct {
+//      Server gtest.Lazy[*httptest.Server] `fixture:"MockApiServer"`
+//    }) {
+//      if needsServer {
+//        server := fixtures.Server.Get()
+//      }
+//    }
+//
+// Fixture is resolved with the same tag options and cached the same way as
+// fixtures injected directly. Copies of a Lazy field share the fixture value.
+// Lazy fields are only supported in fixtures struct of SubTest, BeforeEach and
+// AfterEach methods, and Get panics once the test has finished.
+type Lazy[T any] struct {
+	resolve func() reflect.Value
+}
+
+func (l *Lazy[T]) valueType() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}
+
+func (l *Lazy[T]) bind(resolve func() reflect.Value) {
+	l.resolve = resolve
+}
+
+// Get returns fixture value, constructing the fixture on first call. Failure
+// to construct the fixture fails the test the field has been injected for.
+func (l Lazy[T]) Get() T {
+	if l.resolve == nil {
+		panic("Lazy fixture needs to be injected by gtest before calling Get")
+	}
+	v, _ := l.resolve().Interface().(T)
+	return v
+}
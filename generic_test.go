@@ -0,0 +1,138 @@
+package gtest_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/houqp/gtest"
+	"github.com/stretchr/testify/assert"
+)
+
+// typed fixture generating unique sequence numbers
+type TypedSeqFixture struct {
+	Count int
+}
+
+func (s *TypedSeqFixture) Construct(t *testing.T) (int, any, error) {
+	s.Count += 1
+	return s.Count, nil, nil
+}
+
+func (s *TypedSeqFixture) Destruct(t *testing.T, ctx any) error {
+	return nil
+}
+
+// typed fixture fetching its dependency through handle
+type TypedLabelFixture struct{}
+
+func (s TypedLabelFixture) Construct(t *testing.T) (string, any, error) {
+	return fmt.Sprintf("label_%d", typedSeq.Get(t)), nil, nil
+}
+
+func (s TypedLabelFixture) Destruct(t *testing.T, ctx any) error {
+	return nil
+}
+
+var (
+	typedSeq   = gtest.MustRegister[int, any]("TypedSeq", &TypedSeqFixture{}, gtest.ScopeCall)
+	typedLabel = gtest.MustRegister[string, any]("TypedLabel", TypedLabelFixture{}, gtest.ScopeSubTest)
+)
+
+type TypedFixtureTests struct{}
+
+func (s *TypedFixtureTests) Setup(t *testing.T)      {}
+func (s *TypedFixtureTests) Teardown(t *testing.T)   {}
+func (s *TypedFixtureTests) BeforeEach(t *testing.T) {}
+func (s *TypedFixtureTests) AfterEach(t *testing.T)  {}
+
+func (s *TypedFixtureTests) SubTestGet(t *testing.T) {
+	assert.NotEqual(t, typedSeq.Get(t), typedSeq.Get(t))
+	// subtest scoped fixture is cached
+	assert.Equal(t, typedLabel.Get(t), typedLabel.Get(t))
+}
+
+// typed fixtures can be injected with struct tags as well
+func (s *TypedFixtureTests) SubTestStructTag(t *testing.T, fixtures struct {
+	Label string `fixture:"TypedLabel"`
+}) {
+	assert.Equal(t, "TypedLabel", typedLabel.Name())
+	assert.Equal(t, fixtures.Label, typedLabel.Get(t))
+}
+
+func (s *TypedFixtureTests) SubTestUseAs(t *testing.T) {
+	assert.Equal(t, typedLabel.Get(t), gtest.UseAs[string](t, "TypedLabel"))
+}
+
+func TestTypedFixture(t *testing.T) {
+	gtest.RunSubTests(t, &TypedFixtureTests{})
+
+	_, err := gtest.Register[string, any]("TypedLabel", TypedLabelFixture{}, gtest.ScopeSubTest)
+	assert.EqualError(t, err, "Fixture 'TypedLabel' has already been registered under scope: subtest")
+	assert.Panics(t, func() {
+		gtest.MustRegister[string, any]("TypedLabel", TypedLabelFixture{}, gtest.ScopeSubTest)
+	})
+}
+
+type LazyTests struct {
+	Counter *UseCounterFixture
+	// fixtures struct of SubTestUsed, kept to check Get after the subtest
+	Used struct {
+		Count gtest.Lazy[int] `fixture:"LazyCounter"`
+	}
+}
+
+func (s *LazyTests) SubTestNotUsed(t *testing.T, fixtures struct {
+	Count gtest.Lazy[int] `fixture:"LazyCounter"`
+}) {
+	assert.Equal(t, 0, s.Counter.Constructed)
+}
+
+func (s *LazyTests) SubTestUsed(t *testing.T, fixtures struct {
+	Count gtest.Lazy[int] `fixture:"LazyCounter"`
+	Port  gtest.Lazy[int] `fixture:"LazyPort,default=8080"`
+}) {
+	assert.Equal(t, 1, fixtures.Count.Get())
+	assert.Equal(t, 1, fixtures.Count.Get())
+	assert.Equal(t, 1, s.Counter.Constructed)
+	assert.Equal(t, 8080, fixtures.Port.Get())
+	s.Used.Count = fixtures.Count
+}
+
+func TestLazyFixture(t *testing.T) {
+	counter := &UseCounterFixture{}
+	reg := gtest.NewRegistry()
+	reg.MustRegister("LazyCounter", counter, gtest.ScopeSubTest)
+	tests := &LazyTests{Counter: counter}
+	gtest.RunSubTests(t, tests, gtest.WithRegistry(reg))
+	assert.Equal(t, 1, counter.Constructed)
+	assert.Equal(t, 1, counter.Destructed)
+	assert.PanicsWithValue(t,
+		"SubTestUsed's Lazy fixture Count used after its test has finished",
+		func() { tests.Used.Count.Get() })
+	assert.Equal(t, 1, counter.Constructed)
+
+	err := gtest.Validate(&LazyInvalidTests{})
+	if assert.Error(t, err) {
+		problems := err.(*gtest.ValidationError).Problems
+		assert.Len(t, problems, 3)
+		assert.Contains(t, err.Error(), "fixture Label has type int, fixture 'TypedLabel' returns string")
+		assert.Contains(t, err.Error(),
+			"*gtest_test.LazyInvalidTests: Lazy fixture field Label is only supported in fixtures struct of SubTest, BeforeEach and AfterEach methods")
+		assert.Contains(t, err.Error(),
+			"*gtest_test.LazyInvalidTests.Setup's fixture Label is Lazy, which is only supported in fixtures struct of SubTest, BeforeEach and AfterEach methods")
+	}
+}
+
+type LazyInvalidTests struct {
+	Label gtest.Lazy[string] `fixture:"TypedLabel"`
+}
+
+func (s *LazyInvalidTests) Setup(t *testing.T, fixtures struct {
+	Label gtest.Lazy[string] `fixture:"TypedLabel"`
+}) {
+}
+
+func (s *LazyInvalidTests) SubTestWrongType(t *testing.T, fixtures struct {
+	Label gtest.Lazy[int] `fixture:"TypedLabel"`
+}) {
+}
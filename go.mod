@@ -1,9 +1,15 @@
 module github.com/houqp/gtest
 
-go 1.13
+go 1.18
 
 require (
 	github.com/fatih/structtag v1.2.0
 	github.com/stretchr/testify v1.4.0
 	go.uber.org/goleak v0.10.1-0.20191111212139-7380c5a9fa84
 )
+
+require (
+	github.com/davecgh/go-spew v1.1.0 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	gopkg.in/yaml.v2 v2.2.2 // indirect
+)
@@ -1,12 +1,15 @@
 package gtest
 
 import (
+	"context"
 	"fmt"
+	"os"
 	"reflect"
+	"runtime/debug"
 	"strings"
+	"sync"
 	"testing"
-
-	"github.com/fatih/structtag"
+	"time"
 )
 
 type FixtureScope string
@@ -20,31 +23,192 @@ const (
 	ScopeSubTest FixtureScope = "subtest"
 	// ScopeCall fixture will return different value for each reference in fixtures struct.
 	ScopeCall FixtureScope = "call"
+	// ScopeGroup fixture's value will be constructed on first reference and
+	// cached for all subtests within the same RunSubTests call. It is
+	// destructed after the group's Teardown hook returns. Construct errors
+	// are cached as well, and reported to every subtest using the fixture.
+	//
+	// Construct is called with *testing.T of the test referencing the
+	// fixture first, which may be a subtest finishing long before the
+	// fixture is destructed. Don't tie fixture value to t, e.g. with
+	// t.TempDir or t.Cleanup, release resources in Destruct instead.
+	//
+	// Good usecase for this scope is expensive resources like a seeded
+	// database or a test HTTP server shared by a test group.
+	ScopeGroup FixtureScope = "group"
+	// ScopeSession fixture's value will be constructed on first reference and
+	// cached for the whole test binary. Session fixtures are destructed in
+	// reverse construction order by Main after all tests are completed. Same
+	// as ScopeGroup, Construct errors are cached and Construct is called with
+	// *testing.T of the test referencing the fixture first.
+	//
+	// Good usecase for this scope is a local stand-in server shared by all
+	// integration tests in a package.
+	ScopeSession FixtureScope = "session"
 
-	testMethodPrefix = "SubTest"
+	testMethodPrefix  = "SubTest"
+	casesMethodPrefix = "Cases"
+	groupPrefix       = "Group"
 )
 
+// rank orders fixture scopes by lifetime, a fixture can only depend on
+// fixtures with the same or wider scope. ScopeCall fixtures are constructed
+// for each reference, so they take on the lifetime of whoever requested them
+// and are allowed as dependency of any fixture. Unknown scopes return -1.
+func (s FixtureScope) rank() int {
+	switch s {
+	case ScopeCall:
+		return 0
+	case ScopeSubTest:
+		return 1
+	case ScopeGroup:
+		return 2
+	case ScopeSession:
+		return 3
+	}
+	return -1
+}
+
+// checkScopeDependency returns error if fixture with callerScope is not
+// allowed to depend on fixture with depScope.
+func checkScopeDependency(caller string, callerScope FixtureScope, dep string, depScope FixtureScope) error {
+	if depScope == ScopeCall || depScope.rank() >= callerScope.rank() {
+		return nil
+	}
+	return fmt.Errorf(
+		"ScopeMismatch: %s with scope %s cannot depend on fixture '%s' with narrower scope %s",
+		caller, callerScope, dep, depScope)
+}
+
 // Subtests are grouped in struct that implements GTest interface.
 // Each test should be implemented as a struct method with `SubTest` as prefix.
+//
+// Implementing GTest is optional, a test group only needs to implement the
+// hooks it uses, see SetupGroup, TeardownGroup, BeforeEacher and AfterEacher.
 type GTest interface {
-	// Setup is called before any subtest runs in a test group.
+	SetupGroup
+	TeardownGroup
+	BeforeEacher
+	AfterEacher
+}
+
+// Test groups passed to RunSubTests can implement any of the following hook
+// interfaces, or their variants returning error. Returned error fails the
+// test the same way as t.Fatal.
+
+type SetupGroup interface {
+	// Setup is called before any subtest runs in a test group. Subtests are
+	// skipped if Setup fails.
 	Setup(t *testing.T)
+}
+
+type SetupGroupE interface {
+	Setup(t *testing.T) error
+}
+
+type TeardownGroup interface {
 	// Teardown is called after all subtests are completed in a test group.
+	// It is always called once Setup has started.
 	Teardown(t *testing.T)
+}
 
-	// BeforeEach is called before each subtest runs.
+type TeardownGroupE interface {
+	Teardown(t *testing.T) error
+}
+
+type BeforeEacher interface {
+	// BeforeEach is called before each subtest runs. Test body is skipped if
+	// BeforeEach fails, but AfterEach is still called.
 	BeforeEach(t *testing.T)
-	// AfterEach is called after each subtest is completed.
-	// A good use case is doing go routine leak check in this method.
+}
+
+type BeforeEacherE interface {
+	BeforeEach(t *testing.T) error
+}
+
+type AfterEacher interface {
+	// AfterEach is called after each subtest is completed and its fixtures
+	// are destructed. A good use case is doing go routine leak check in this
+	// method.
 	AfterEach(t *testing.T)
 }
 
-type FixtureEntry struct {
-	Scope    FixtureScope
-	Instance interface{}
+type AfterEacherE interface {
+	AfterEach(t *testing.T) error
+}
+
+// groupHooks holds lifecycle hook methods of a test group. Besides
+// *testing.T, hooks can take a fixtures struct as second parameter, fixtures
+// are resolved at group scope for Setup and Teardown, and at subtest scope for
+// BeforeEach and AfterEach.
+type groupHooks struct {
+	setup      reflect.Value
+	teardown   reflect.Value
+	beforeEach reflect.Value
+	afterEach  reflect.Value
+}
+
+// lookupGroupHooks finds lifecycle hook methods of a test group and validates
+// their signatures. All hooks are optional, missing hooks are left unset.
+func lookupGroupHooks(xv reflect.Value) (groupHooks, error) {
+	hooks := groupHooks{}
+	for name, hook := range map[string]*reflect.Value{
+		"Setup":      &hooks.setup,
+		"Teardown":   &hooks.teardown,
+		"BeforeEach": &hooks.beforeEach,
+		"AfterEach":  &hooks.afterEach,
+	} {
+		hookVal := xv.MethodByName(name)
+		if !hookVal.IsValid() {
+			continue
+		}
+		hookType := hookVal.Type()
+		if hookType.NumIn() < 1 || hookType.NumIn() > 2 ||
+			hookType.In(0) != reflect.TypeOf(&testing.T{}) ||
+			(hookType.NumIn() == 2 && hookType.In(1).Kind() != reflect.Struct) ||
+			hookType.NumOut() > 1 ||
+			(hookType.NumOut() == 1 && hookType.Out(0) != errorType) {
+			return hooks, fmt.Errorf(
+				"Method %s needs to take *testing.T and optional fixtures struct, "+
+					"and optionally return error, got: %s",
+				name, hookType)
+		}
+		*hook = hookVal
+	}
+	return hooks, nil
+}
+
+// callHook calls lifecycle hook of a test group, resolving its fixtures
+// with resolver and registry from frame. Unset hooks are ignored.
+func callHook(t *testing.T, hookVal reflect.Value, frame resolveFrame) {
+	if !hookVal.IsValid() {
+		return
+	}
+	defer pushResolveFrame(t, frame)()
+	callParams := []reflect.Value{reflect.ValueOf(t)}
+	if hookVal.Type().NumIn() == 2 {
+		fixturesVal, err := frame.resolver.resolve(t, frame, hookVal.Type().In(1))
+		if err != nil {
+			t.Fatalf("Failed to resolve fixtures for %s: %v", frame.caller, err)
+		}
+		callParams = append(callParams, fixturesVal)
+	}
+	returns := hookVal.Call(callParams)
+	if len(returns) == 1 && !returns[0].IsNil() {
+		t.Fatalf("%s failed: %v", frame.caller, returns[0].Interface())
+	}
 }
 
-var registeredFixtures map[string]FixtureEntry = map[string]FixtureEntry{}
+var (
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+)
+
+// takesContext returns true if method takes context.Context as first
+// parameter. Method type is expected to include receiver as first input.
+func takesContext(mType reflect.Type) bool {
+	return mType.NumIn() > 1 && mType.In(1) == contextType
+}
 
 func validateFixtureConstructMethod(fType reflect.Type) error {
 	constructMethod, ok := fType.MethodByName("Construct")
@@ -52,28 +216,45 @@ func validateFixtureConstructMethod(fType reflect.Type) error {
 		return fmt.Errorf("%s missing required Construct method.", fType.String())
 	}
 
-	if constructMethod.Type.NumIn() != 3 {
+	// skip receiver and optional context
+	offset := 1
+	if takesContext(constructMethod.Type) {
+		offset = 2
+	}
+
+	// skip optional *Request
+	numIn := constructMethod.Type.NumIn() - offset
+	if numIn == 3 && constructMethod.Type.In(offset+1) == requestType {
+		numIn = 2
+	}
+	if numIn != 2 {
 		return fmt.Errorf(
 			"%s's Construct method needs to take exactly 2 input parameter as fixtures struct, got: %d.",
-			fType.String(), constructMethod.Type.NumIn()-1)
+			fType.String(), numIn)
 	}
-	if constructMethod.Type.NumOut() != 2 {
+	numOut := constructMethod.Type.NumOut()
+	if numOut != 2 && numOut != 3 {
 		return fmt.Errorf(
-			"%s's Construct method needs to return exactly 2 output parameters as as value and destruct context, got: %d.",
-			fType.String(), constructMethod.Type.NumOut())
+			"%s's Construct method needs to return 2 output parameters as value and destruct context, with an optional error, got: %d.",
+			fType.String(), numOut)
+	}
+	if numOut == 3 && constructMethod.Type.Out(2) != errorType {
+		return fmt.Errorf(
+			"%s's Construct method needs to return error as third output parameter, got: %s",
+			fType.String(), constructMethod.Type.Out(2).String())
 	}
 
-	arg1 := constructMethod.Type.In(1)
+	arg1 := constructMethod.Type.In(offset)
 	if arg1.String() != "*testing.T" {
 		return fmt.Errorf(
 			"%s's Construct method needs to take *testing.T as first argument, got: %s",
 			fType.String(), arg1.String())
 	}
 
-	arg2 := constructMethod.Type.In(2)
+	arg2 := constructMethod.Type.In(constructMethod.Type.NumIn() - 1)
 	if arg2.Kind() != reflect.Struct {
 		return fmt.Errorf(
-			"%s's Construct method needs to take a struct as second argument",
+			"%s's Construct method needs to take a struct as last argument",
 			fType.String())
 	}
 
@@ -85,13 +266,25 @@ func validateFixtureDestructMethod(fType reflect.Type) error {
 	if !ok {
 		return fmt.Errorf("%s missing required Destruct method.", fType.String())
 	}
-	if destructMethod.Type.NumIn() != 3 {
+
+	// skip receiver and optional context
+	offset := 1
+	if takesContext(destructMethod.Type) {
+		offset = 2
+	}
+
+	if destructMethod.Type.NumIn()-offset != 2 {
 		return fmt.Errorf(
 			"%s's Destruct method needs to take exactly 2 input parameter as destruct context, got %d.",
-			fType.String(), destructMethod.Type.NumIn()-1)
+			fType.String(), destructMethod.Type.NumIn()-offset)
+	}
+	numOut := destructMethod.Type.NumOut()
+	if numOut > 1 || (numOut == 1 && destructMethod.Type.Out(0) != errorType) {
+		return fmt.Errorf(
+			"%s's Destruct method can only return an optional error.", fType.String())
 	}
 
-	arg1 := destructMethod.Type.In(1)
+	arg1 := destructMethod.Type.In(offset)
 	if arg1.String() != "*testing.T" {
 		return fmt.Errorf(
 			"%s's Destruct method needs to take *testing.T as first argument, got: %s",
@@ -105,7 +298,7 @@ func validateFixtureDestructMethod(fType reflect.Type) error {
 	}
 	constructOutCtx := constructMethod.Type.Out(1)
 
-	arg2 := destructMethod.Type.In(2)
+	arg2 := destructMethod.Type.In(offset + 1)
 	if arg2.String() != constructOutCtx.String() {
 		return fmt.Errorf(
 			"%s's Destruct method needs to take %s as second argument, got: %s",
@@ -115,204 +308,1509 @@ func validateFixtureDestructMethod(fType reflect.Type) error {
 	return nil
 }
 
-// Register a fixture under a given name. A fixture needs to be registered
-// before it can be used in tests or other fixtures.
-func RegisterFixture(name string, f interface{}, scope FixtureScope) error {
-	entry, ok := registeredFixtures[name]
-	if ok {
-		return fmt.Errorf(
-			"Fixture '%s' has already been registered under scope: %s",
-			name, entry.Scope)
-	}
+var cleanUpFuncType = reflect.TypeOf(func() {})
 
-	fType := reflect.TypeOf(f)
+// validateFixtureFunc checks signature of construct function registered with
+// RegisterFixtureFunc.
+func validateFixtureFunc(fnType reflect.Type) error {
+	if fnType.Kind() != reflect.Func {
+		return fmt.Errorf("Fixture function needs to be a function, got: %s", fnType.String())
+	}
 
-	err := validateFixtureConstructMethod(fType)
-	if err != nil {
-		return err
+	// skip optional context
+	offset := 0
+	if fnType.NumIn() > 0 && fnType.In(0) == contextType {
+		offset = 1
 	}
 
-	err = validateFixtureDestructMethod(fType)
-	if err != nil {
-		return err
+	// skip optional *Request
+	numIn := fnType.NumIn() - offset
+	if numIn == 3 && fnType.In(offset+1) == requestType {
+		numIn = 2
+	}
+	if numIn != 2 {
+		return fmt.Errorf(
+			"Fixture function %s needs to take exactly 2 input parameter as *testing.T and fixtures struct, got: %d.",
+			fnType.String(), numIn)
+	}
+	arg1 := fnType.In(offset)
+	if arg1.String() != "*testing.T" {
+		return fmt.Errorf(
+			"Fixture function %s needs to take *testing.T as first argument, got: %s",
+			fnType.String(), arg1.String())
+	}
+	arg2 := fnType.In(fnType.NumIn() - 1)
+	if arg2.Kind() != reflect.Struct {
+		return fmt.Errorf(
+			"Fixture function %s needs to take a struct as last argument", fnType.String())
 	}
 
-	registeredFixtures[name] = FixtureEntry{
-		Scope:    scope,
-		Instance: f,
+	numOut := fnType.NumOut()
+	if numOut != 2 && numOut != 3 {
+		return fmt.Errorf(
+			"Fixture function %s needs to return 2 output parameters as value and cleanup function, with an optional error, got: %d.",
+			fnType.String(), numOut)
+	}
+	if fnType.Out(1) != cleanUpFuncType {
+		return fmt.Errorf(
+			"Fixture function %s needs to return func() as second output parameter, got: %s",
+			fnType.String(), fnType.Out(1).String())
+	}
+	if numOut == 3 && fnType.Out(2) != errorType {
+		return fmt.Errorf(
+			"Fixture function %s needs to return error as third output parameter, got: %s",
+			fnType.String(), fnType.Out(2).String())
 	}
+
 	return nil
 }
 
-// Register a fixture, panic if registration failed.
-func MustRegisterFixture(name string, f interface{}, scope FixtureScope) {
-	err := RegisterFixture(name, f, scope)
-	if err != nil {
-		panic(fmt.Sprintf("Failed to register fixture: %v", err))
+// fixtureDependencies returns names of fixtures referenced by fixtures struct.
+// Fields without fixture name depend on provider of their type among
+// fixtures, they are skipped if there isn't exactly one provider.
+func fixtureDependencies(fixtures map[string]FixtureEntry, fixturesType reflect.Type) []string {
+	deps := []string{}
+	for j := 0; j < fixturesType.NumField(); j++ {
+		field := fixturesType.Field(j)
+		ftag, _, err := parseFixtureTag(field)
+		if err != nil {
+			continue
+		}
+		if ftag.Name == "" {
+			if providers := typeProviders(fixtures, fieldValueType(field.Type)); len(providers) == 1 {
+				deps = append(deps, providers[0])
+			}
+			continue
+		}
+		deps = append(deps, ftag.Name)
 	}
+	return deps
 }
 
-func GetFixture(name string) (FixtureEntry, bool) {
-	val, ok := registeredFixtures[name]
-	return val, ok
+// fieldFixture returns name of fixture injected into field. Fields tagged
+// without fixture name are injected with provider of their type, empty name
+// is returned for optional fields if there is no provider.
+func fieldFixture(reg *Registry, caller string, ftag fixtureTag, field reflect.StructField) (string, error) {
+	if ftag.Name != "" {
+		return ftag.Name, nil
+	}
+	valueType := fieldValueType(field.Type)
+	providers := reg.providers(valueType)
+	switch {
+	case len(providers) == 1:
+		return providers[0], nil
+	case len(providers) > 1:
+		return "", fmt.Errorf(
+			"Ambiguous fixture providers for %s's fixture %s of type %s: %s",
+			caller, field.Name, valueType, strings.Join(providers, ", "))
+	case ftag.Optional || ftag.HasDefault:
+		return "", nil
+	default:
+		return "", fmt.Errorf(
+			"No fixture provides type %s for %s's fixture %s", valueType, caller, field.Name)
+	}
+}
+
+// resolvedFixture is a cached fixture value. done is closed once construction
+// completes, so subtests running in parallel can wait for a fixture being
+// constructed by another subtest.
+type resolvedFixture struct {
+	done chan struct{}
+	val  reflect.Value
+	err  error
 }
 
 type fixtureResolver struct {
-	// Resolved is keyed off registered fixture instance This means same.
-	//
-	// fixture instance registered under different names will be considered as
-	// one.
-	Resolved map[interface{}]reflect.Value
+	// mu guards Resolved and cleanUpCbs, group and session resolvers are
+	// shared by subtests running in parallel.
+	mu sync.Mutex
+	// Resolved is keyed off registered fixture instance and its registry.
+	// This means same fixture instance registered under different names in
+	// the same registry will be considered as one.
+	Resolved map[cacheKey]*resolvedFixture
+
+	// scope of fixtures cached by this resolver
+	scope FixtureScope
+	// parent resolver holds fixtures with wider scope
+	parent     *fixtureResolver
+	cleanUpCbs []func(t *testing.T)
+	// ended is set once cleanUp has destructed all fixtures
+	ended bool
+
+	// ctx is passed to fixtures that take context.Context, it is cancelled
+	// after all fixtures owned by this resolver are destructed.
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
-func newFixtureResolver() *fixtureResolver {
+// newFixtureResolver creates resolver for fixtures of given scope. If t is not
+// nil, resolver's context will be bounded by t's deadline.
+func newFixtureResolver(t *testing.T, scope FixtureScope, parent *fixtureResolver) *fixtureResolver {
+	ctx := context.Background()
+	if parent != nil {
+		ctx = parent.ctx
+	}
+	var cancel context.CancelFunc
+	deadline, ok := time.Time{}, false
+	if t != nil {
+		deadline, ok = t.Deadline()
+	}
+	if ok {
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+
 	f := fixtureResolver{
-		Resolved: make(map[interface{}]reflect.Value),
+		Resolved: make(map[cacheKey]*resolvedFixture),
+		scope:    scope,
+		parent:   parent,
+		ctx:      ctx,
+		cancel:   cancel,
 	}
 	return &f
 }
 
-func (self *fixtureResolver) resolve(t *testing.T, fixturesType reflect.Type, caller string, cleanUpCbs *[]func()) reflect.Value {
+// owner returns the resolver responsible for caching and destructing fixtures
+// of given scope.
+func (self *fixtureResolver) owner(scope FixtureScope) *fixtureResolver {
+	if scope == ScopeCall {
+		return self
+	}
+	for r := self; r != nil; r = r.parent {
+		if r.scope == scope {
+			return r
+		}
+	}
+	return self
+}
+
+// cleanUp destructs all fixtures constructed by this resolver in reverse
+// construction order, so fixtures are always destructed before their
+// dependencies.
+//
+// Remaining callbacks are deferred before invoking each callback, this makes
+// sure all fixtures are destructed even if one of the Destruct methods calls
+// t.FailNow.
+func (self *fixtureResolver) cleanUp(t *testing.T) {
+	self.mu.Lock()
+	n := len(self.cleanUpCbs)
+	if n == 0 {
+		self.Resolved = make(map[cacheKey]*resolvedFixture)
+		self.ended = true
+		self.mu.Unlock()
+		self.cancel()
+		return
+	}
+	cb := self.cleanUpCbs[n-1]
+	self.cleanUpCbs = self.cleanUpCbs[:n-1]
+	self.mu.Unlock()
+	defer self.cleanUp(t)
+	cb(t)
+}
+
+// hasEnded returns true once resolver's scope has ended and all its fixtures
+// have been destructed.
+func (self *fixtureResolver) hasEnded() bool {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return self.ended
+}
+
+// addCleanUp schedules cb to be called when resolver's scope ends.
+func (self *fixtureResolver) addCleanUp(cb func(t *testing.T)) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.cleanUpCbs = append(self.cleanUpCbs, cb)
+}
+
+// callDestruct invokes fixture's Destruct method or cleanup function returned
+// by fixture function, and reports returned error or panic as test error so it
+// won't prevent other fixtures from being destructed.
+func callDestruct(
+	ctx context.Context, t *testing.T, name string, destructVal reflect.Value, ctxVal reflect.Value,
+) {
+	defer func() {
+		if r := recover(); r != nil {
+			t.Errorf("Fixture '%s' Destruct panicked: %v\n%s", name, r, debug.Stack())
+		}
+	}()
+	var callParams []reflect.Value
+	switch destructVal.Type().NumIn() {
+	case 2:
+		callParams = []reflect.Value{reflect.ValueOf(t), ctxVal}
+	case 3:
+		callParams = []reflect.Value{reflect.ValueOf(ctx), reflect.ValueOf(t), ctxVal}
+	}
+	returns := destructVal.Call(callParams)
+	if len(returns) == 1 && !returns[0].IsNil() {
+		t.Errorf("Fixture '%s' Destruct failed: %v", name, returns[0].Interface())
+	}
+}
+
+// fixtureError records the chain of fixtures that led to a fixture
+// construction error, e.g. "MockComment -> MockUser -> UserId: connection
+// refused".
+type fixtureError struct {
+	Chain []string
+	Err   error
+}
+
+func (e *fixtureError) Error() string {
+	return fmt.Sprintf("%s: %v", strings.Join(e.Chain, " -> "), e.Err)
+}
+
+func (e *fixtureError) Unwrap() error {
+	return e.Err
+}
+
+// chainFixtureError prepends fixture name to error's fixture chain.
+func chainFixtureError(name string, err error) error {
+	if ferr, ok := err.(*fixtureError); ok {
+		return &fixtureError{
+			Chain: append([]string{name}, ferr.Chain...),
+			Err:   ferr.Err,
+		}
+	}
+	return &fixtureError{Chain: []string{name}, Err: err}
+}
+
+// cacheKey identifies a cached fixture value. Fixture instances shared by
+// cloned registries are cached per registry, since their dependencies may be
+// registered differently. Values of fixtures depending on parametrized
+// fixtures are cached per selected parameter, and values requested with
+// arguments are cached per set of arguments.
+type cacheKey struct {
+	registry *Registry
+	key      interface{}
+	params   string
+	args     string
+}
+
+// paramsKey encodes parameters selected for fixture entry and all its
+// parametrized dependencies.
+func paramsKey(name string, fentry FixtureEntry, params map[string]int) string {
+	names := parametrizedFixtures(fentry.registry, fentry.registry.dependencies(fentry.fixturesType()))
+	if len(fentry.Params) > 0 {
+		names = append([]string{name}, names...)
+	}
+	parts := make([]string, len(names))
+	for i, n := range names {
+		parts[i] = fmt.Sprintf("%s=%d", n, params[n])
+	}
+	return strings.Join(parts, ",")
+}
+
+// construct returns value for fixture entry, fixture dependencies are resolved
+// using the same resolver so they share the lifetime of the fixture.
+func (self *fixtureResolver) construct(
+	t *testing.T, frame resolveFrame, name string, fentry FixtureEntry, req *Request,
+) (reflect.Value, error) {
+	if _, ok := frame.params[name]; len(fentry.Params) > 0 && !ok {
+		return reflect.Value{}, fmt.Errorf(
+			"Parametrized fixture '%s' needs to be referenced in fixtures struct of %s",
+			name, frame.caller)
+	}
+
+	if fentry.Scope == ScopeCall {
+		return self.constructFixture(t, frame, name, fentry, req)
+	}
+
+	key := cacheKey{
+		registry: fentry.registry,
+		key:      fentry.key,
+		params:   paramsKey(name, fentry, frame.params),
+		args:     argsKey(req.Args),
+	}
+	// nested test groups reuse values constructed by enclosing groups
+	for r := self.parent; r != nil && r.scope == self.scope; r = r.parent {
+		r.mu.Lock()
+		cached, ok := r.Resolved[key]
+		r.mu.Unlock()
+		if ok {
+			<-cached.done
+			return cached.val, cached.err
+		}
+	}
+
+	self.mu.Lock()
+	if cached, ok := self.Resolved[key]; ok {
+		self.mu.Unlock()
+		<-cached.done
+		return cached.val, cached.err
+	}
+	cached := &resolvedFixture{done: make(chan struct{})}
+	self.Resolved[key] = cached
+	self.mu.Unlock()
+
+	// err is only left unset if construction was aborted by t.FailNow or a
+	// panic. Construct errors are cached as well, so a failing fixture is
+	// not constructed again by every test within its scope.
+	valVal, err := reflect.Value{}, fmt.Errorf("fixture '%s' construct did not complete", name)
+	defer func() {
+		cached.val, cached.err = valVal, err
+		close(cached.done)
+	}()
+	if fentry.Scope == ScopeSession {
+		warnWithoutMain(os.Stderr, name)
+	}
+	valVal, err = self.constructFixture(t, frame, name, fentry, req)
+	return valVal, err
+}
+
+// constructFixture calls fixture's Construct and schedules its Destruct.
+func (self *fixtureResolver) constructFixture(
+	t *testing.T, frame resolveFrame, name string, fentry FixtureEntry, req *Request,
+) (reflect.Value, error) {
+	// dependencies and fixtures requested imperatively from Construct are
+	// resolved as dependencies of this fixture
+	fixtureFrame := resolveFrame{
+		resolver:    self,
+		registry:    fentry.registry,
+		caller:      fmt.Sprintf("fixture '%s'", name),
+		callerScope: fentry.Scope,
+		fixture:     name,
+		chain:       append(append([]string{}, frame.chain...), name),
+		params:      frame.params,
+		group:       frame.group,
+		subTest:     frame.subTest,
+	}
+
+	// input and output types are checked at runtime by RegisterFixture method
+	depsVal, err := self.resolve(t, fixtureFrame, fentry.fixturesType())
+	if err != nil {
+		return reflect.Value{}, chainFixtureError(name, err)
+	}
+	callParams := []reflect.Value{
+		reflect.ValueOf(t),
+		depsVal,
+	}
+	constructVal := fentry.constructVal
+	if takesRequest(constructVal.Type()) {
+		req.Group = frame.group
+		req.SubTest = frame.subTest
+		req.Scope = fentry.Scope
+		if idx, ok := frame.params[name]; ok {
+			req.Param = fentry.Params[idx]
+		}
+		// finalizers are scheduled before Destruct so they're called after it
+		self.addCleanUp(func(t *testing.T) { req.finalize() })
+		callParams = []reflect.Value{reflect.ValueOf(t), reflect.ValueOf(req), depsVal}
+	}
+	ctx := self.ctx
+	if fentry.ConstructTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, fentry.ConstructTimeout)
+		self.addCleanUp(func(t *testing.T) { cancel() })
+	}
+	if constructVal.Type().In(0) == contextType {
+		callParams = append([]reflect.Value{reflect.ValueOf(ctx)}, callParams...)
+	}
+	call := func() []reflect.Value {
+		fentry.instanceMu.Lock()
+		defer fentry.instanceMu.Unlock()
+		return constructVal.Call(callParams)
+	}
+	returns, err := func() ([]reflect.Value, error) {
+		defer pushResolveFrame(t, fixtureFrame)()
+		if fentry.ConstructTimeout > 0 {
+			return self.callWithTimeout(name, fentry, call)
+		}
+		return call(), nil
+	}()
+	if err != nil {
+		return reflect.Value{}, chainFixtureError(name, err)
+	}
+	if len(returns) == 3 && !returns[2].IsNil() {
+		return reflect.Value{}, chainFixtureError(name, returns[2].Interface().(error))
+	}
+	if destruct := self.destructFunc(name, fentry, returns[1]); destruct != nil {
+		self.addCleanUp(destruct)
+	}
+	return returns[0], nil
+}
+
+// callWithTimeout calls Construct of fixture registered with
+// WithConstructTimeout in its own goroutine, so construction fails once the
+// timeout passes even if Construct doesn't return after its context is
+// cancelled.
+//
+// Value returned after the timeout is destructed with other fixtures of the
+// resolver. Construct gets another timeout period to return when the
+// resolver's scope ends, otherwise its value is never destructed.
+func (self *fixtureResolver) callWithTimeout(
+	name string, fentry FixtureEntry, call func() []reflect.Value,
+) ([]reflect.Value, error) {
+	var returns []reflect.Value
+	var panicked interface{}
+	done := make(chan struct{})
+	go func() {
+		// returns is left unset if Construct calls t.FailNow
+		defer close(done)
+		defer func() {
+			if r := recover(); r != nil {
+				panicked = fmt.Sprintf("%v\n%s", r, debug.Stack())
+			}
+		}()
+		returns = call()
+	}()
+
+	timer := time.NewTimer(fentry.ConstructTimeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+		if panicked != nil {
+			panic(panicked)
+		}
+		if returns == nil {
+			return nil, fmt.Errorf("construct did not complete")
+		}
+		return returns, nil
+	case <-timer.C:
+	}
+
+	self.addCleanUp(func(t *testing.T) {
+		grace := time.NewTimer(fentry.ConstructTimeout)
+		defer grace.Stop()
+		select {
+		case <-done:
+		case <-grace.C:
+			t.Errorf("Fixture '%s' Construct did not return after exceeding its timeout, "+
+				"its value won't be destructed", name)
+			return
+		}
+		if panicked != nil {
+			t.Errorf("Fixture '%s' Construct panicked: %v", name, panicked)
+			return
+		}
+		if returns == nil || (len(returns) == 3 && !returns[2].IsNil()) {
+			return
+		}
+		if destruct := self.destructFunc(name, fentry, returns[1]); destruct != nil {
+			destruct(t)
+		}
+	})
+	return nil, fmt.Errorf("construct exceeded %s", fentry.ConstructTimeout)
+}
+
+// destructFunc returns function destructing fixture value constructed along
+// with destruct context ctxVal, or nil if there is nothing to destruct.
+func (self *fixtureResolver) destructFunc(name string, fentry FixtureEntry, ctxVal reflect.Value) func(t *testing.T) {
+	destructCtx := self.ctx
+	if fentry.destructVal.IsValid() {
+		return func(t *testing.T) {
+			fentry.instanceMu.Lock()
+			defer fentry.instanceMu.Unlock()
+			callDestruct(destructCtx, t, name, fentry.destructVal, ctxVal)
+		}
+	} else if !ctxVal.IsNil() {
+		// function fixtures return cleanup closure instead of destruct context
+		return func(t *testing.T) {
+			callDestruct(destructCtx, t, name, ctxVal, reflect.Value{})
+		}
+	}
+	return nil
+}
+
+// resolveFixture returns value of a single fixture registered under name,
+// constructing it if needed. req is passed to fixture's Construct, nil
+// request is treated as a request without arguments.
+func (self *fixtureResolver) resolveFixture(
+	t *testing.T, frame resolveFrame, name string, req *Request,
+) (reflect.Value, error) {
+	if req == nil {
+		req = &Request{}
+	}
+	fentry, ok := frame.registry.Get(name)
+	if !ok {
+		return reflect.Value{}, fmt.Errorf(
+			"Unregistered fixture found for caller %s: %s", frame.caller, name)
+	}
+	if cycle := dependencyCycle(frame.chain, name); cycle != nil {
+		return reflect.Value{}, fmt.Errorf(
+			"Fixture dependency cycle found for caller %s: %s",
+			frame.caller, strings.Join(cycle, " -> "))
+	}
+
+	// ScopeCall fixtures are constructed by the resolver of whoever
+	// requested them, so their dependencies are checked against scope of
+	// current resolver.
+	effectiveScope := frame.callerScope
+	if effectiveScope == ScopeCall {
+		effectiveScope = self.scope
+	}
+	err := checkScopeDependency(frame.caller, effectiveScope, name, fentry.Scope)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+
+	return self.owner(fentry.Scope).construct(t, frame, name, fentry, req)
+}
+
+// resolve builds fixtures struct for caller described by frame. Caller's
+// scope is used to detect dependencies on fixtures with narrower scope.
+//
+// Construct errors are returned with the chain of fixtures that led to them.
+func (self *fixtureResolver) resolve(t *testing.T, frame resolveFrame, fixturesType reflect.Type) (reflect.Value, error) {
 	kind := fixturesType.Kind()
 	if kind != reflect.Struct {
-		t.Fatalf("Invalid type for fixtures parameter, needs to be struct, got: %d", kind)
+		return reflect.Value{}, fmt.Errorf(
+			"Invalid type for fixtures parameter, needs to be struct, got: %s", kind)
 	}
 	fixturesVal := reflect.Indirect(reflect.New(fixturesType))
 
 	// iterate each field from fixtures struct
 	for j := 0; j < fixturesType.NumField(); j++ {
 		field := fixturesType.Field(j)
-		fieldTagStr := string(field.Tag)
-		tags, err := structtag.Parse(fieldTagStr)
+		// fields without fixture tag are injected based on their type
+		ftag, _, err := parseFixtureTag(field)
 		if err != nil {
-			t.Fatalf("Invalid tag encountered for fixture: %s", fieldTagStr)
-			continue
+			return reflect.Value{}, err
 		}
-		fixgureTag, err := tags.Get("fixture")
+
+		err = self.resolveField(t, frame, ftag, field, fixturesVal.Field(j))
 		if err != nil {
-			t.Fatalf(
-				"Struct field (%s %s) missing fixture tag for caller %s",
-				field.Name, field.Type, caller)
-			continue
+			return reflect.Value{}, err
 		}
-		fentry, ok := registeredFixtures[fixgureTag.Name]
-		if !ok {
-			t.Fatalf(
-				"Unregistered fixture found for caller %s: %s", caller, *fixgureTag)
-		}
-
-		f := fentry.Instance
-
-		var valVal reflect.Value
-		ok = false
-		switch fentry.Scope {
-		case ScopeSubTest:
-			valVal, ok = self.Resolved[f]
-		}
-
-		if !ok {
-			// Type for fixture struct
-			fType := reflect.TypeOf(f)
-			// Value for fixture struct
-			fVal := reflect.ValueOf(f)
-			// input and output types are checked at runtime by RegisterFixture method
-			constructMethod, _ := fType.MethodByName("Construct")
-			constructType := constructMethod.Type
-			callParams := []reflect.Value{
-				reflect.ValueOf(t),
-				self.resolve(
-					t, constructType.In(2), fmt.Sprintf("%s.Construct", fType.String()), cleanUpCbs),
-			}
-			constructVal := fVal.MethodByName("Construct")
-			returns := constructVal.Call(callParams)
-			valVal = returns[0]
-			ctxVal := returns[1]
-
-			*cleanUpCbs = append(*cleanUpCbs, func() {
-				destructVal := fVal.MethodByName("Destruct")
-				destructVal.Call([]reflect.Value{
-					reflect.ValueOf(t),
-					ctxVal,
-				})
-			})
+	}
 
-			if fentry.Scope == ScopeSubTest {
-				self.Resolved[f] = valVal
+	return fixturesVal, nil
+}
+
+// resolveField resolves fixture referenced by fixture tag and assigns its
+// value to struct field. Unregistered optional fixtures are left with zero
+// value, or set to default value from the tag.
+func (self *fixtureResolver) resolveField(
+	t *testing.T, frame resolveFrame, ftag fixtureTag, field reflect.StructField, fieldVal reflect.Value,
+) error {
+	if !fieldVal.CanSet() {
+		return fmt.Errorf(
+			"%s's fixture %s needs to be an exported struct field", frame.caller, field.Name)
+	}
+	if lazy, ok := fieldVal.Addr().Interface().(lazyField); ok {
+		if err := checkLazyField(frame.caller, frame.callerScope, frame.fixture != "", field); err != nil {
+			return err
+		}
+		// fixture is resolved into a value of wrapped type on first Get
+		field.Type = lazy.valueType()
+		lazy.bind(self.lazyResolve(t, frame, ftag, field))
+		return nil
+	}
+	name, err := fieldFixture(frame.registry, frame.caller, ftag, field)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := frame.registry.Get(name); !ok && (ftag.Optional || ftag.HasDefault) {
+		if !ftag.HasDefault {
+			return nil
+		}
+		defaultVal, err := parseDefault(ftag.Default, field.Type)
+		if err != nil {
+			return fmt.Errorf(
+				"%s's fixture %s has invalid default value: %v", frame.caller, field.Name, err)
+		}
+		fieldVal.Set(defaultVal)
+		return nil
+	}
+
+	req := &Request{Field: field.Name, Options: ftag.Options, Args: ftag.Args}
+	valVal, err := self.resolveFixture(t, frame, name, req)
+	if err != nil {
+		return err
+	}
+	if !valVal.Type().AssignableTo(field.Type) {
+		return fmt.Errorf(
+			"%s's fixture %s has type %s, fixture '%s' returns %s",
+			frame.caller, field.Name, field.Type, name, valVal.Type())
+	}
+	fieldVal.Set(valVal)
+	return nil
+}
+
+// lazyResolve returns function resolving fixture for Lazy field on its first
+// call. Lazy fields are only injected for the test calling Get, so failing to
+// construct the fixture fails t. The function panics if it's called after
+// scope of the resolver has ended, since the fixture value would never be
+// destructed, or has already been destructed.
+func (self *fixtureResolver) lazyResolve(
+	t *testing.T, frame resolveFrame, ftag fixtureTag, field reflect.StructField,
+) func() reflect.Value {
+	var mu sync.Mutex
+	var val reflect.Value
+	return func() reflect.Value {
+		mu.Lock()
+		defer mu.Unlock()
+		if self.hasEnded() {
+			panic(fmt.Sprintf(
+				"%s's Lazy fixture %s used after its test has finished", frame.caller, field.Name))
+		}
+		if !val.IsValid() {
+			fieldVal := reflect.New(field.Type).Elem()
+			if err := self.resolveField(t, frame, ftag, field, fieldVal); err != nil {
+				t.Fatalf("Failed to resolve lazy fixture %s for %s: %v", field.Name, frame.caller, err)
 			}
+			val = fieldVal
 		}
+		return val
+	}
+}
 
-		fixturesValField := fixturesVal.FieldByName(field.Name)
-		if fixturesValField.CanSet() {
-			fixturesValField.Set(valVal)
+// checkLazyField returns error if Lazy field is requested outside of fixtures
+// struct taken by SubTest, BeforeEach or AfterEach methods. Get could
+// otherwise be called from a different test than the one the field has been
+// injected for, or after the test has finished.
+func checkLazyField(caller string, callerScope FixtureScope, byFixture bool, field reflect.StructField) error {
+	if !byFixture && callerScope == ScopeSubTest {
+		return nil
+	}
+	return fmt.Errorf(
+		"%s's fixture %s is Lazy, which is only supported in fixtures struct of SubTest, BeforeEach and AfterEach methods",
+		caller, field.Name)
+}
+
+// lazyField is implemented by *Lazy[T]. Fields of Lazy type are bound to a
+// function resolving the fixture instead of being set to fixture value.
+type lazyField interface {
+	// valueType returns type of the wrapped fixture value.
+	valueType() reflect.Type
+	bind(resolve func() reflect.Value)
+}
+
+var lazyFieldType = reflect.TypeOf((*lazyField)(nil)).Elem()
+
+// isLazyField returns true if field is of Lazy type.
+func isLazyField(field reflect.StructField) bool {
+	return reflect.PtrTo(field.Type).Implements(lazyFieldType)
+}
+
+// fieldValueType returns type of fixture value injected into field of type
+// typ, which is the wrapped type for Lazy fields.
+func fieldValueType(typ reflect.Type) reflect.Type {
+	if reflect.PtrTo(typ).Implements(lazyFieldType) {
+		return reflect.New(typ).Interface().(lazyField).valueType()
+	}
+	return typ
+}
+
+// resolveFrame describes who is requesting fixtures and which resolver should
+// be used to resolve them. Frames are also tracked per test to resolve
+// fixtures requested imperatively, e.g. through Handle.Get.
+type resolveFrame struct {
+	resolver    *fixtureResolver
+	registry    *Registry
+	caller      string
+	callerScope FixtureScope
+	// fixture being constructed, empty for subtests
+	fixture string
+	// chain of fixtures being constructed, outermost first, used to detect
+	// dependency cycles
+	chain []string
+	// params maps parametrized fixture names to index of selected parameter
+	params map[string]int
+	// group and subTest identify test group and SubTest method fixtures are
+	// requested for, they are exposed to fixtures through Request
+	group   reflect.Type
+	subTest string
+}
+
+var (
+	resolveFramesMu sync.Mutex
+	// resolveFrames is a stack of frames per test, frame on top of the stack
+	// is the current one.
+	resolveFrames = map[*testing.T][]resolveFrame{}
+)
+
+// pushResolveFrame makes frame the current frame for t, returned function
+// restores previous frame.
+func pushResolveFrame(t *testing.T, frame resolveFrame) func() {
+	resolveFramesMu.Lock()
+	resolveFrames[t] = append(resolveFrames[t], frame)
+	resolveFramesMu.Unlock()
+
+	return func() {
+		resolveFramesMu.Lock()
+		defer resolveFramesMu.Unlock()
+		frames := resolveFrames[t]
+		if len(frames) <= 1 {
+			delete(resolveFrames, t)
 		} else {
-			t.Fatalf("%s's fixture %s needs to be an exported struct field", caller, field.Name)
+			resolveFrames[t] = frames[:len(frames)-1]
 		}
 	}
+}
 
-	return fixturesVal
+// currentResolveFrame returns frame on top of t's frame stack.
+func currentResolveFrame(t *testing.T) (resolveFrame, bool) {
+	resolveFramesMu.Lock()
+	defer resolveFramesMu.Unlock()
+	frames := resolveFrames[t]
+	if len(frames) == 0 {
+		return resolveFrame{}, false
+	}
+	return frames[len(frames)-1], true
 }
 
-// Run a group of sub tests.
-func RunSubTests(t *testing.T, gt GTest) {
-	// inspired by https://github.com/grpc/grpc-go/pull/2523/files
-	xt := reflect.TypeOf(gt)
-	xv := reflect.ValueOf(gt)
+// resolveByName resolves fixture using current frame of t.
+func resolveByName(t *testing.T, name string) (reflect.Value, error) {
+	frame, ok := currentResolveFrame(t)
+	if !ok {
+		return reflect.Value{}, fmt.Errorf(
+			"Cannot resolve fixture '%s' outside of RunSubTests for test %s", name, t.Name())
+	}
+	return frame.resolver.resolveFixture(t, frame, name, nil)
+}
+
+// Use returns value of fixture registered under name for t, constructing it
+// if needed. It resolves the fixture on demand the same way as fixtures
+// struct fields: values are cached according to fixture's scope, and the
+// fixture is destructed together with other fixtures of its scope. Use can be
+// called from subtests, hooks and Construct of other fixtures.
+func Use(t *testing.T, name string) interface{} {
+	t.Helper()
+	val, err := resolveByName(t, name)
+	if err != nil {
+		t.Fatalf("Failed to resolve fixture '%s': %v", name, err)
+	}
+	return val.Interface()
+}
+
+// Param returns parameter selected for the parametrized fixture being
+// constructed for t. It is meant to be called from Construct of fixtures
+// registered with parameters, nil is returned otherwise.
+func Param(t *testing.T) interface{} {
+	frame, ok := currentResolveFrame(t)
+	if !ok || frame.fixture == "" {
+		return nil
+	}
+	idx, ok := frame.params[frame.fixture]
+	if !ok {
+		return nil
+	}
+	fentry, _ := frame.registry.Get(frame.fixture)
+	return fentry.Params[idx]
+}
+
+// parametrizedFixtures returns names of parametrized fixtures among deps,
+// including transitive dependencies, in order of first reference.
+func parametrizedFixtures(reg *Registry, deps []string) []string {
+	names := []string{}
+	visited := map[string]bool{}
+	var walk func(reg *Registry, deps []string)
+	walk = func(reg *Registry, deps []string) {
+		for _, name := range deps {
+			if visited[name] {
+				continue
+			}
+			visited[name] = true
+			fentry, ok := reg.Get(name)
+			if !ok {
+				continue
+			}
+			if len(fentry.Params) > 0 {
+				names = append(names, name)
+			}
+			walk(fentry.registry, fentry.registry.dependencies(fentry.fixturesType()))
+		}
+	}
+	walk(reg, deps)
+	return names
+}
+
+// paramCombinations expands parametrized fixtures into cartesian product of
+// their parameters. Each combination maps fixture name to parameter index.
+func paramCombinations(reg *Registry, names []string) []map[string]int {
+	combos := []map[string]int{{}}
+	for _, name := range names {
+		fentry, _ := reg.Get(name)
+		expanded := []map[string]int{}
+		for _, combo := range combos {
+			for idx := range fentry.Params {
+				next := map[string]int{name: idx}
+				for k, v := range combo {
+					next[k] = v
+				}
+				expanded = append(expanded, next)
+			}
+		}
+		combos = expanded
+	}
+	return combos
+}
 
-	gt.Setup(t)
+// paramsTestName builds subtest name from selected fixture parameters.
+func paramsTestName(reg *Registry, names []string, combo map[string]int) string {
+	parts := make([]string, len(names))
+	for i, name := range names {
+		fentry, _ := reg.Get(name)
+		parts[i] = fmt.Sprint(fentry.Params[combo[name]])
+	}
+	return strings.Join(parts, "-")
+}
 
+// subTestMethods returns all methods of a test group with SubTest prefix.
+func subTestMethods(xt reflect.Type) []reflect.Method {
+	methods := []reflect.Method{}
 	for i := 0; i < xt.NumMethod(); i++ {
-		// use resolver to cache Fixture construct per test/method
-		resolver := newFixtureResolver()
+		method := xt.Method(i)
+		if strings.HasPrefix(method.Name, testMethodPrefix) {
+			methods = append(methods, method)
+		}
+	}
+	return methods
+}
+
+// nestedGroup is a test group nested in another test group.
+type nestedGroup struct {
+	name  string
+	group interface{}
+}
 
+// nestedGroups returns test groups nested in a test group, either as methods
+// with Group prefix returning a test group, or as exported fields with Group
+// prefix holding one. Group methods are called each time nestedGroups is
+// called, so RunSubTests only calls it once Setup of the enclosing group has
+// succeeded.
+func nestedGroups(xv reflect.Value) []nestedGroup {
+	groups := []nestedGroup{}
+	xt := xv.Type()
+	for i := 0; i < xt.NumMethod(); i++ {
 		method := xt.Method(i)
-		methodName := method.Name
-		if !strings.HasPrefix(methodName, testMethodPrefix) {
+		if !isGroupMethod(method, map[reflect.Type]bool{}) {
 			continue
 		}
+		group := xv.Method(i).Call(nil)[0]
+		if group.Kind() == reflect.Interface {
+			group = group.Elem()
+		}
+		if !group.IsValid() || !isTestGroupType(group.Type(), map[reflect.Type]bool{}) || isNilValue(group) {
+			continue
+		}
+		groups = append(groups, nestedGroup{
+			name:  strings.TrimPrefix(method.Name, groupPrefix),
+			group: group.Interface(),
+		})
+	}
 
-		// method.Type.NumIn() includes struct itself into the count, but value.Call()
-		// doesn't count struct as input parameter.
-		methodParamCount := method.Type.NumIn() - 1
+	sv := reflect.Indirect(xv)
+	if sv.Kind() != reflect.Struct {
+		return groups
+	}
+	for i := 0; i < sv.NumField(); i++ {
+		field := sv.Type().Field(i)
+		fieldVal := sv.Field(i)
+		if !isGroupField(field, map[reflect.Type]bool{}) {
+			continue
+		}
+		if field.Type.Kind() == reflect.Struct && fieldVal.CanAddr() {
+			// hooks are usually defined with pointer receivers
+			fieldVal = fieldVal.Addr()
+		}
+		if isNilValue(fieldVal) {
+			continue
+		}
+		groups = append(groups, nestedGroup{
+			name:  strings.TrimPrefix(field.Name, groupPrefix),
+			group: fieldVal.Interface(),
+		})
+	}
+	return groups
+}
 
-		t.Run(strings.TrimPrefix(methodName, testMethodPrefix), func(t *testing.T) {
-			callParams := make([]reflect.Value, methodParamCount)
-			cleanUpCbs := []func(){}
-			if methodParamCount < 1 {
-				t.Fatalf("Method %v must have *testing.T as first parameter, got nothing.", methodName)
-			}
+// nestedGroupNames returns names of methods and fields of test group type xt
+// that may hold nested test groups, without calling any Group methods.
+func nestedGroupNames(xt reflect.Type) []string {
+	names := []string{}
+	for i := 0; i < xt.NumMethod(); i++ {
+		if method := xt.Method(i); isGroupMethod(method, map[reflect.Type]bool{}) {
+			names = append(names, strings.TrimPrefix(method.Name, groupPrefix))
+		}
+	}
+	if xt.Kind() == reflect.Ptr {
+		xt = xt.Elem()
+	}
+	if xt.Kind() != reflect.Struct {
+		return names
+	}
+	for i := 0; i < xt.NumField(); i++ {
+		if field := xt.Field(i); isGroupField(field, map[reflect.Type]bool{}) {
+			names = append(names, strings.TrimPrefix(field.Name, groupPrefix))
+		}
+	}
+	return names
+}
 
-			// first parameter should be testing.T
-			argType := method.Type.In(1).String()
-			if argType != "*testing.T" {
-				t.Fatalf(
-					"Method %v must have *testing.T as first parameter, got: %s",
-					methodName, argType)
-			}
+// isGroupMethod returns true for methods with Group prefix taking no
+// parameters and returning a test group or an interface which may hold one.
+// Method type includes receiver.
+func isGroupMethod(method reflect.Method, seen map[reflect.Type]bool) bool {
+	if !strings.HasPrefix(method.Name, groupPrefix) ||
+		method.Type.NumIn() != 1 || method.Type.NumOut() != 1 {
+		return false
+	}
+	outType := method.Type.Out(0)
+	return outType.Kind() == reflect.Interface || isTestGroupType(outType, seen)
+}
 
-			// second optional parameter should be fixtures struct
-			if methodParamCount == 2 {
-				fixturesType := method.Type.In(2)
-				callParams[1] = resolver.resolve(t, fixturesType, methodName, &cleanUpCbs)
-			} else if methodParamCount > 2 {
-				t.Fatalf(
-					"Method %s cannot take more than 2 parameters, got %d.",
-					methodName, methodParamCount)
-			}
+// isGroupField returns true for exported fields with Group prefix holding a
+// test group.
+func isGroupField(field reflect.StructField, seen map[reflect.Type]bool) bool {
+	return strings.HasPrefix(field.Name, groupPrefix) && field.PkgPath == "" &&
+		isTestGroupType(field.Type, seen)
+}
 
-			tfunc := xv.MethodByName(methodName)
+// isTestGroupType returns true for struct and pointer to struct types with
+// SubTest methods or nested test groups. seen holds struct types already
+// being checked, so recursive types don't loop forever.
+func isTestGroupType(typ reflect.Type, seen map[reflect.Type]bool) bool {
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct || seen[typ] {
+		return false
+	}
+	seen[typ] = true
+	// method set of pointer type includes methods with value receivers
+	pt := reflect.PtrTo(typ)
+	if len(subTestMethods(pt)) > 0 {
+		return true
+	}
+	for i := 0; i < pt.NumMethod(); i++ {
+		if isGroupMethod(pt.Method(i), seen) {
+			return true
+		}
+	}
+	for i := 0; i < typ.NumField(); i++ {
+		if isGroupField(typ.Field(i), seen) {
+			return true
+		}
+	}
+	return false
+}
 
-			gt.BeforeEach(t)
+// isNilValue returns true for nil pointers and interfaces.
+func isNilValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	}
+	return false
+}
 
-			callParams[0] = reflect.ValueOf(t)
-			tfunc.Call(callParams)
+// groupField is a field of test group struct tagged with fixture tag.
+type groupField struct {
+	field reflect.StructField
+	tag   fixtureTag
+	// err is set if fixture tag is invalid
+	err error
+}
 
-			for _, cb := range cleanUpCbs {
-				cb()
-			}
+// groupFixtureFields returns fields of test group struct tagged with fixture
+// tag, split into fields injected once for the whole group and fields
+// injected for each subtest based on scope of their fixtures.
+func groupFixtureFields(xv reflect.Value, reg *Registry) (groupFields, subTestFields []groupField) {
+	if xv.Kind() != reflect.Ptr || xv.Elem().Kind() != reflect.Struct {
+		return nil, nil
+	}
+	xt := xv.Elem().Type()
+	for i := 0; i < xt.NumField(); i++ {
+		field := xt.Field(i)
+		ftag, ok, err := parseFixtureTag(field)
+		if !ok && err == nil {
+			continue
+		}
+		gf := groupField{field: field, tag: ftag, err: err}
+		if gf.err == nil && isLazyField(field) {
+			gf.err = fmt.Errorf(
+				"Lazy fixture field %s is only supported in fixtures struct of SubTest, BeforeEach and AfterEach methods",
+				field.Name)
+		}
+		// unregistered fixtures and missing type providers are reported when
+		// group fields are injected
+		name, _ := fieldFixture(reg, "", ftag, field)
+		fentry, ok := reg.Get(name)
+		if ok && fentry.Scope.rank() < ScopeGroup.rank() {
+			subTestFields = append(subTestFields, gf)
+		} else {
+			groupFields = append(groupFields, gf)
+		}
+	}
+	return groupFields, subTestFields
+}
+
+// injectFields sets test group fields to their fixture values.
+func (r *groupRunner) injectFields(t *testing.T, frame resolveFrame, fields []groupField) {
+	if len(fields) == 0 {
+		return
+	}
+	sv := r.xv.Elem()
+	for _, gf := range fields {
+		err := gf.err
+		if err == nil {
+			err = frame.resolver.resolveField(t, frame, gf.tag, gf.field, sv.FieldByIndex(gf.field.Index))
+		}
+		if err != nil {
+			t.Fatalf("Failed to resolve fixtures for %s: %v", frame.caller, err)
+		}
+	}
+}
+
+// clearFields resets test group fields injected by injectFields.
+func (r *groupRunner) clearFields(fields []groupField) {
+	// only groups passed as pointer to struct have fixture fields
+	if len(fields) == 0 {
+		return
+	}
+	sv := r.xv.Elem()
+	for _, gf := range fields {
+		fieldVal := sv.FieldByIndex(gf.field.Index)
+		if fieldVal.CanSet() {
+			fieldVal.Set(reflect.Zero(gf.field.Type))
+		}
+	}
+}
 
-			gt.AfterEach(t)
+type runConfig struct {
+	registry *Registry
+	parallel bool
+}
+
+// RunOption configures how RunSubTests runs a test group.
+type RunOption func(cfg *runConfig)
+
+// WithRegistry resolves fixtures for a test group from reg instead of
+// DefaultRegistry.
+func WithRegistry(reg *Registry) RunOption {
+	return func(cfg *runConfig) {
+		cfg.registry = reg
+	}
+}
+
+// WithParallel runs subtests of a test group in parallel with each other by
+// calling t.Parallel.
+//
+// Parallel subtests only start after the test function calling RunSubTests
+// returns, so Teardown and group fixture Destruct methods are called from
+// t.Cleanup once all subtests have finished. Wrap RunSubTests in t.Run to
+// wait for the subtests to finish.
+//
+// Construct and Destruct calls on the same fixture instance are serialized,
+// but BeforeEach, AfterEach and SubTest methods need to be safe for
+// concurrent use. Test group fields injected for each subtest are shared by
+// all subtests, so they are rejected by Validate, use fixtures struct
+// parameter instead.
+func WithParallel() RunOption {
+	return func(cfg *runConfig) {
+		cfg.parallel = true
+	}
+}
+
+// Run a group of sub tests. Test group can be any type with SubTest methods,
+// lifecycle hooks from GTest are optional and can return error. Hooks can
+// optionally take a fixtures struct as second parameter:
+//
+//    func (s *SampleTests) BeforeEach(t *testing.T, fixtures struct {
+//      DirPath string `fixture:"WorkDir"`
+//    }) {}
+//
+// Setup and Teardown share ScopeGroup fixture values with subtests,
+// BeforeEach and AfterEach share ScopeSubTest fixture values with the subtest
+// they are called for. AfterEach taking fixtures is called before the
+// subtest's fixtures are destructed.
+//
+// Once Setup is called, Teardown is guaranteed to be called even if Setup
+// calls t.FailNow or a subtest panics. If Setup fails, all subtests in the
+// group are skipped. The test group is checked with Validate before Setup is
+// called.
+//
+// Test groups can be nested through methods or fields with Group prefix,
+// holding or returning a group struct or pointer to one:
+//
+//    func (s *APITests) GroupUsers() interface{} {
+//      return &UserTests{client: s.client}
+//    }
+//
+// Only struct types with SubTest methods or nested groups of their own are
+// run as nested groups. Group methods are called, and fields read, once Setup
+// of the enclosing group has succeeded, so nested groups can use state set up
+// by it. Nested group is checked with Validate before its own Setup.
+//
+// Nested group runs as a subtest named after the method or field, e.g.
+// "Users". It reuses ScopeGroup fixture values constructed by enclosing
+// groups, and BeforeEach and AfterEach of enclosing groups are called around
+// its own.
+func RunSubTests(t *testing.T, gt interface{}, opts ...RunOption) {
+	cfg := runConfig{registry: DefaultRegistry}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	r := &groupRunner{cfg: cfg, autoFixtures: cfg.registry.autouse()}
+	r.run(t, gt, sessionResolver)
+}
+
+// groupRunner runs subtests and nested groups of a single test group.
+type groupRunner struct {
+	cfg   runConfig
+	xv    reflect.Value
+	hooks groupHooks
+	// resolver caches ScopeGroup fixtures for all subtests of the group
+	resolver *fixtureResolver
+	// autoFixtures are constructed for every SubTest, including the ones
+	// inherited from enclosing groups
+	autoFixtures []string
+	// groupFields and subTestFields are test group fields injected with
+	// fixture values for the whole group and for each subtest
+	groupFields   []groupField
+	subTestFields []groupField
+	// parent runs the enclosing group, nil for top level groups
+	parent *groupRunner
+}
+
+// chain returns runners of enclosing groups and r, outermost first.
+func (r *groupRunner) chain() []*groupRunner {
+	if r.parent == nil {
+		return []*groupRunner{r}
+	}
+	return append(r.parent.chain(), r)
+}
+
+func (r *groupRunner) frame(hook string) resolveFrame {
+	return resolveFrame{
+		resolver:    r.resolver,
+		registry:    r.cfg.registry,
+		caller:      hook,
+		callerScope: ScopeGroup,
+		group:       r.xv.Type(),
+	}
+}
+
+// run calls group's Setup, runs all subtests and nested groups, then calls
+// Teardown.
+func (r *groupRunner) run(t *testing.T, gt interface{}, parentResolver *fixtureResolver) {
+	cfg := r.cfg
+	// report all problems in the group before running any of it, nested
+	// groups are checked once they are returned after Setup
+	if err := validate(gt, cfg, r.autoFixtures, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// inspired by https://github.com/grpc/grpc-go/pull/2523/files
+	r.xv = reflect.ValueOf(gt)
+	methods := subTestMethods(r.xv.Type())
+
+	hooks, err := lookupGroupHooks(r.xv)
+	if err != nil {
+		t.Fatalf("Invalid test group: %v", err)
+	}
+	r.hooks = hooks
+
+	r.resolver = newFixtureResolver(t, ScopeGroup, parentResolver)
+	r.groupFields, r.subTestFields = groupFixtureFields(r.xv, cfg.registry)
+
+	var teardownOnce sync.Once
+	teardown := func() {
+		teardownOnce.Do(func() {
+			defer r.clearFields(r.groupFields)
+			defer r.resolver.cleanUp(t)
+			callHook(t, r.hooks.teardown, r.frame("Teardown"))
 		})
 	}
+	// A panic in subtest aborts the test binary without running deferred
+	// calls in this goroutine, but cleanup functions of parent tests are
+	// still invoked.
+	t.Cleanup(teardown)
+	if !cfg.parallel {
+		defer teardown()
+	}
+
+	setupSucceeded := false
+	defer func() {
+		if setupSucceeded {
+			return
+		}
+		if r := recover(); r != nil {
+			panic(r)
+		}
+		reason := "group setup failed"
+		if t.Skipped() && !t.Failed() {
+			reason = "group setup skipped"
+		}
+		names := []string{}
+		for _, method := range methods {
+			names = append(names, strings.TrimPrefix(method.Name, testMethodPrefix))
+		}
+		names = append(names, nestedGroupNames(r.xv.Type())...)
+		for _, name := range names {
+			t.Run(name, func(t *testing.T) {
+				t.Skip(reason)
+			})
+		}
+	}()
+
+	failedBeforeSetup := t.Failed()
+	// group fields are injected before Setup, failing to resolve them fails
+	// Setup
+	r.injectFields(t, r.frame(r.xv.Type().String()), r.groupFields)
+	callHook(t, r.hooks.setup, r.frame("Setup"))
+	if !failedBeforeSetup && t.Failed() {
+		return
+	}
+	setupSucceeded = true
+
+	// autouse fixtures from group's AutoFixtures method are constructed for
+	// every SubTest in the group and nested groups
+	if af, ok := gt.(interface{ AutoFixtures() []string }); ok {
+		r.autoFixtures = append(append([]string{}, r.autoFixtures...), af.AutoFixtures()...)
+	}
+
+	for _, method := range methods {
+		r.runMethod(t, method)
+	}
+
+	// Group methods are called after Setup, so nested groups can be built
+	// from state set up by the enclosing group
+	for _, group := range nestedGroups(r.xv) {
+		group := group
+		t.Run(group.name, func(t *testing.T) {
+			if cfg.parallel {
+				t.Parallel()
+			}
+			child := &groupRunner{cfg: cfg, autoFixtures: r.autoFixtures, parent: r}
+			child.run(t, group.group, r.resolver)
+		})
+	}
+}
+
+// runMethod runs a SubTest method, expanding it into one subtest per test
+// case and per combination of fixture parameters.
+func (r *groupRunner) runMethod(t *testing.T, method reflect.Method) {
+	cfg := r.cfg
+	methodName := method.Name
+	testName := strings.TrimPrefix(methodName, testMethodPrefix)
+
+	// method.Type.NumIn() includes struct itself into the count, but value.Call()
+	// doesn't count struct as input parameter.
+	methodParamCount := method.Type.NumIn() - 1
+
+	// SubTestFoo paired with CasesFoo takes test case as last parameter
+	casesVal := r.xv.MethodByName(casesMethodPrefix + testName)
+	hasCases := casesVal.IsValid()
+	fixturesIdx := 2
+	if methodParamCount < 2 || (hasCases && methodParamCount < 3) {
+		fixturesIdx = -1
+	}
+
+	// SubTests using parametrized fixtures run once per combination of
+	// fixture parameters
+	deps := append([]string{}, r.autoFixtures...)
+	if fixturesIdx > 0 && method.Type.In(fixturesIdx).Kind() == reflect.Struct {
+		deps = append(deps, cfg.registry.dependencies(method.Type.In(fixturesIdx))...)
+	}
+	paramNames := parametrizedFixtures(cfg.registry, deps)
+	runParams := func(t *testing.T, caseVal reflect.Value) {
+		if len(paramNames) == 0 {
+			r.runSubTest(t, method, nil, caseVal)
+			return
+		}
+		for _, params := range paramCombinations(cfg.registry, paramNames) {
+			params := params
+			t.Run(paramsTestName(cfg.registry, paramNames, params), func(t *testing.T) {
+				if cfg.parallel {
+					t.Parallel()
+				}
+				r.runSubTest(t, method, params, caseVal)
+			})
+		}
+	}
+
+	t.Run(testName, func(t *testing.T) {
+		if cfg.parallel {
+			t.Parallel()
+		}
+		if !hasCases {
+			runParams(t, reflect.Value{})
+			return
+		}
+		cases, err := testCases(casesVal)
+		if err != nil {
+			t.Fatalf("Invalid test cases for %s: %v", methodName, err)
+		}
+		for i := 0; i < cases.Len(); i++ {
+			caseVal := cases.Index(i)
+			t.Run(testCaseName(caseVal, i), func(t *testing.T) {
+				if cfg.parallel {
+					t.Parallel()
+				}
+				runParams(t, caseVal)
+			})
+		}
+	})
+}
+
+// runSubTest runs a single subtest with given fixture parameters and test
+// case, wrapped in BeforeEach and AfterEach of the group and all enclosing
+// groups.
+func (r *groupRunner) runSubTest(t *testing.T, method reflect.Method, params map[string]int, caseVal reflect.Value) {
+	methodName := method.Name
+	methodParamCount := method.Type.NumIn() - 1
+	casesName := casesMethodPrefix + strings.TrimPrefix(methodName, testMethodPrefix)
+	hasCases := caseVal.IsValid()
+	maxParamCount := 2
+	if hasCases {
+		maxParamCount = 3
+	}
+
+	// AfterEach hooks are deferred before fixtures are resolved so they're
+	// called even if the subtest calls t.FailNow or panics. They're called
+	// after all fixtures are destructed, unless they take fixtures
+	// themselves and need to share their values with the subtest.
+	chain := r.chain()
+	// subtest scoped group fields are cleared after AfterEach is called
+	for _, g := range chain {
+		defer g.clearFields(g.subTestFields)
+	}
+	beforeEachCalled := 0
+	var hookFrame func(hook string) resolveFrame
+	var afterEach func(i int, takesFixtures bool)
+	afterEach = func(i int, takesFixtures bool) {
+		if i < 0 {
+			return
+		}
+		// outer AfterEach is called even if inner one calls t.FailNow
+		defer afterEach(i-1, takesFixtures)
+		hook := chain[i].hooks.afterEach
+		if hook.IsValid() && (hook.Type().NumIn() == 2) == takesFixtures {
+			callHook(t, hook, hookFrame("AfterEach"))
+		}
+	}
+	defer func() { afterEach(beforeEachCalled-1, false) }()
+
+	// use resolver to cache Fixture construct per test/method
+	resolver := newFixtureResolver(t, ScopeSubTest, r.resolver)
+	defer resolver.cleanUp(t)
+	frame := resolveFrame{
+		resolver:    resolver,
+		registry:    r.cfg.registry,
+		caller:      methodName,
+		callerScope: ScopeSubTest,
+		params:      params,
+		group:       r.xv.Type(),
+		subTest:     methodName,
+	}
+	defer pushResolveFrame(t, frame)()
+	hookFrame = func(hook string) resolveFrame {
+		hf := frame
+		hf.caller = hook
+		return hf
+	}
+	defer func() { afterEach(beforeEachCalled-1, true) }()
+
+	callParams := make([]reflect.Value, methodParamCount)
+	if methodParamCount < 1 {
+		t.Fatalf("Method %v must have *testing.T as first parameter, got nothing.", methodName)
+	}
+
+	// first parameter should be testing.T
+	argType := method.Type.In(1).String()
+	if argType != "*testing.T" {
+		t.Fatalf(
+			"Method %v must have *testing.T as first parameter, got: %s",
+			methodName, argType)
+	}
 
-	gt.Teardown(t)
+	if methodParamCount > maxParamCount {
+		t.Fatalf(
+			"Method %s cannot take more than %d parameters, got %d.",
+			methodName, maxParamCount, methodParamCount)
+	}
+
+	// last parameter should be test case if the method has cases
+	if hasCases {
+		if methodParamCount < 2 {
+			t.Fatalf(
+				"Method %s must take test case from %s as last parameter.",
+				methodName, casesName)
+		}
+		caseType := method.Type.In(methodParamCount)
+		if !caseVal.Type().AssignableTo(caseType) {
+			t.Fatalf(
+				"Method %s takes test case of type %s, %s returns %s",
+				methodName, caseType, casesName, caseVal.Type())
+		}
+		callParams[methodParamCount-1] = caseVal
+	}
+
+	// autouse fixtures are constructed before fixtures requested by the
+	// SubTest, so they are destructed last
+	for _, name := range r.autoFixtures {
+		_, err := resolver.resolveFixture(t, frame, name, nil)
+		if err != nil {
+			t.Fatalf("Failed to resolve autouse fixtures for %s: %v", methodName, err)
+		}
+	}
+
+	// optional parameter after testing.T should be fixtures struct
+	if methodParamCount == maxParamCount {
+		fixturesType := method.Type.In(2)
+		fixturesVal, err := resolver.resolve(t, frame, fixturesType)
+		if err != nil {
+			t.Fatalf("Failed to resolve fixtures for %s: %v", methodName, err)
+		}
+		callParams[1] = fixturesVal
+	}
+
+	// subtest scoped group fields are injected before BeforeEach
+	for _, g := range chain {
+		g.injectFields(t, hookFrame(g.xv.Type().String()), g.subTestFields)
+	}
+
+	tfunc := r.xv.MethodByName(methodName)
+
+	// BeforeEach of enclosing groups are called first, test body is
+	// skipped if any of them failed without calling t.FailNow
+	for _, g := range chain {
+		failedBeforeEach := t.Failed()
+		beforeEachCalled++
+		callHook(t, g.hooks.beforeEach, hookFrame("BeforeEach"))
+		if !failedBeforeEach && t.Failed() {
+			return
+		}
+	}
+
+	callParams[0] = reflect.ValueOf(t)
+	tfunc.Call(callParams)
+}
+
+// testCases calls cases method of a SubTest, which needs to take no
+// parameters and return a slice of test cases.
+func testCases(casesVal reflect.Value) (reflect.Value, error) {
+	casesType := casesVal.Type()
+	if casesType.NumIn() != 0 || casesType.NumOut() != 1 ||
+		casesType.Out(0).Kind() != reflect.Slice {
+		return reflect.Value{}, fmt.Errorf(
+			"cases method needs to take no parameters and return a slice, got: %s", casesType)
+	}
+	return casesVal.Call(nil)[0], nil
+}
+
+// testCaseName names subtest of a test case using its String method or Name
+// field, falling back to index of the case. Nil cases are named after their
+// index as well.
+func testCaseName(caseVal reflect.Value, idx int) string {
+	if isNilValue(caseVal) {
+		// String method with pointer receiver would panic on nil case
+		return fmt.Sprint(idx)
+	}
+	name := ""
+	if stringer, ok := caseVal.Interface().(fmt.Stringer); ok {
+		name = stringer.String()
+	} else if v := reflect.Indirect(caseVal); v.Kind() == reflect.Struct {
+		if field := v.FieldByName("Name"); field.IsValid() && field.Kind() == reflect.String {
+			name = field.String()
+		}
+	}
+	if name == "" {
+		name = fmt.Sprint(idx)
+	}
+	return name
 }
@@ -0,0 +1,202 @@
+package gtest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os/exec"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// registry with a chain of fixtures failing at the innermost one
+func brokenChainRegistry() *Registry {
+	reg := NewRegistry()
+	reg.MustRegisterFunc("UserId", func(t *testing.T, fixtures struct{}) (int, func(), error) {
+		return 0, nil, errors.New("connection refused")
+	}, ScopeCall)
+	reg.MustRegisterFunc("MockUser", func(t *testing.T, fixtures struct {
+		Id int `fixture:"UserId"`
+	}) (string, func()) {
+		return "user", nil
+	}, ScopeCall)
+	reg.MustRegisterFunc("MockComment", func(t *testing.T, fixtures struct {
+		User string `fixture:"MockUser"`
+	}) (string, func()) {
+		return "comment", nil
+	}, ScopeCall)
+	return reg
+}
+
+func TestResolveErrorChain(t *testing.T) {
+	resolver := newFixtureResolver(t, ScopeSubTest, nil)
+	defer resolver.cleanUp(t)
+	frame := resolveFrame{
+		resolver:    resolver,
+		registry:    brokenChainRegistry(),
+		caller:      "SubTestComment",
+		callerScope: ScopeSubTest,
+	}
+
+	_, err := resolver.resolve(t, frame, reflect.TypeOf(struct {
+		Comment string `fixture:"MockComment"`
+	}{}))
+	assert.EqualError(t, err, "MockComment -> MockUser -> UserId: connection refused")
+
+	var ferr *fixtureError
+	assert.True(t, errors.As(err, &ferr))
+	assert.Equal(t, []string{"MockComment", "MockUser", "UserId"}, ferr.Chain)
+}
+
+// fixture failing to destruct
+type failingDestructFixture struct{}
+
+func (s failingDestructFixture) Construct(t *testing.T, fixtures struct{}) (string, interface{}) {
+	return "value", nil
+}
+
+func (s failingDestructFixture) Destruct(t *testing.T, ctx interface{}) error {
+	return errors.New("device busy")
+}
+
+func TestDestructError(t *testing.T) {
+	stdout, _, err := RunHelperTest(t, "TestDestructErrorHelper")
+	_, ok := err.(*exec.ExitError)
+	assert.True(t, ok)
+	assert.Contains(t, stdout, "Fixture 'FailingDestruct' Destruct failed: device busy")
+	// remaining fixtures are destructed after the failure
+	assert.Contains(t, stdout, "destructed Other")
+	assert.Contains(t, stdout, "--- FAIL: TestDestructErrorHelper")
+}
+
+func TestDestructErrorHelper(t *testing.T) {
+	SkipUnlessHelper(t)
+	reg := NewRegistry()
+	reg.MustRegisterFunc("Other", func(t *testing.T, fixtures struct{}) (string, func()) {
+		return "other", func() { t.Log("destructed Other") }
+	}, ScopeSubTest)
+	reg.MustRegister("FailingDestruct", failingDestructFixture{}, ScopeSubTest)
+
+	resolver := newFixtureResolver(t, ScopeSubTest, nil)
+	frame := resolveFrame{
+		resolver:    resolver,
+		registry:    reg,
+		caller:      "SubTestDestruct",
+		callerScope: ScopeSubTest,
+	}
+	_, err := resolver.resolve(t, frame, reflect.TypeOf(struct {
+		Other   string `fixture:"Other"`
+		Failing string `fixture:"FailingDestruct"`
+	}{}))
+	assert.NoError(t, err)
+	resolver.cleanUp(t)
+}
+
+func TestConstructTimeout(t *testing.T) {
+	destructed := false
+	reg := NewRegistry()
+	reg.MustRegisterFunc("Slow", func(ctx context.Context, t *testing.T, fixtures struct{}) (string, func()) {
+		// context is cancelled once the timeout passes
+		<-ctx.Done()
+		time.Sleep(5 * time.Millisecond)
+		return "slow", func() { destructed = true }
+	}, ScopeSubTest, WithConstructTimeout(10*time.Millisecond))
+
+	resolver := newFixtureResolver(t, ScopeSubTest, nil)
+	frame := resolveFrame{
+		resolver:    resolver,
+		registry:    reg,
+		caller:      "SubTestSlow",
+		callerScope: ScopeSubTest,
+	}
+	_, err := resolver.resolve(t, frame, reflect.TypeOf(struct {
+		Slow string `fixture:"Slow"`
+	}{}))
+	assert.EqualError(t, err, "Slow: construct exceeded 10ms")
+
+	// value returned after the timeout is still destructed
+	resolver.cleanUp(t)
+	assert.True(t, destructed)
+}
+
+func TestConstructErrorCached(t *testing.T) {
+	constructed := 0
+	reg := NewRegistry()
+	reg.MustRegisterFunc("Broken", func(t *testing.T, fixtures struct{}) (string, func(), error) {
+		constructed += 1
+		return "", nil, errors.New("connection refused")
+	}, ScopeGroup)
+
+	resolver := newFixtureResolver(t, ScopeGroup, nil)
+	defer resolver.cleanUp(t)
+	for _, subTest := range []string{"SubTestFirst", "SubTestSecond"} {
+		subTestResolver := newFixtureResolver(t, ScopeSubTest, resolver)
+		frame := resolveFrame{
+			resolver:    subTestResolver,
+			registry:    reg,
+			caller:      subTest,
+			callerScope: ScopeSubTest,
+		}
+		_, err := subTestResolver.resolve(t, frame, reflect.TypeOf(struct {
+			Broken string `fixture:"Broken"`
+		}{}))
+		assert.EqualError(t, err, "Broken: connection refused")
+		subTestResolver.cleanUp(t)
+	}
+	// failed group fixture is not constructed again by the second subtest
+	assert.Equal(t, 1, constructed)
+}
+
+func TestWarnWithoutMain(t *testing.T) {
+	called := atomic.LoadInt32(&mainCalled)
+	defer atomic.StoreInt32(&mainCalled, called)
+	defer func() { warnWithoutMainOnce = sync.Once{} }()
+
+	var out bytes.Buffer
+	atomic.StoreInt32(&mainCalled, 1)
+	warnWithoutMain(&out, "Server")
+	assert.Empty(t, out.String())
+
+	atomic.StoreInt32(&mainCalled, 0)
+	warnWithoutMainOnce = sync.Once{}
+	warnWithoutMain(&out, "Server")
+	warnWithoutMain(&out, "Database")
+	assert.Equal(t,
+		"gtest: session fixture 'Server' is constructed without calling gtest.Main from TestMain, "+
+			"session fixtures won't be destructed\n",
+		out.String())
+}
+
+func TestConstructTimeoutBlocking(t *testing.T) {
+	release := make(chan struct{})
+	destructed := false
+	reg := NewRegistry()
+	reg.MustRegisterFunc("Blocking", func(t *testing.T, fixtures struct{}) (string, func()) {
+		// Construct not watching context is still timed out
+		<-release
+		return "blocking", func() { destructed = true }
+	}, ScopeSubTest, WithConstructTimeout(10*time.Millisecond))
+
+	resolver := newFixtureResolver(t, ScopeSubTest, nil)
+	frame := resolveFrame{
+		resolver:    resolver,
+		registry:    reg,
+		caller:      "SubTestBlocking",
+		callerScope: ScopeSubTest,
+	}
+	_, err := resolver.resolve(t, frame, reflect.TypeOf(struct {
+		Blocking string `fixture:"Blocking"`
+	}{}))
+	assert.EqualError(t, err, "Blocking: construct exceeded 10ms")
+	assert.False(t, destructed)
+
+	// value returned before the scope ends is destructed
+	close(release)
+	resolver.cleanUp(t)
+	assert.True(t, destructed)
+}
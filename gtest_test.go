@@ -1,12 +1,15 @@
 package gtest_test
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"os/exec"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -127,6 +130,76 @@ func (s MockApiServerFixture) Destruct(t *testing.T, ctx ApiServerFixtureCtx) {
 	os.Remove(ctx.DataFile.Name())
 }
 
+// group scoped fixture that counts how many times it has been constructed
+type GroupCounterFixture struct {
+	ConstructCount int
+	AllocatedCount int
+}
+
+func (s *GroupCounterFixture) Construct(t *testing.T, fixtures struct{}) (int, interface{}) {
+	s.ConstructCount += 1
+	s.AllocatedCount += 1
+	return s.ConstructCount, nil
+}
+
+func (s *GroupCounterFixture) Destruct(t *testing.T, ctx interface{}) {
+	s.AllocatedCount -= 1
+}
+
+// subtest scoped fixture built on top of a group scoped fixture
+type GroupCounterLabelFixture struct{}
+
+func (s GroupCounterLabelFixture) Construct(t *testing.T, fixtures struct {
+	Counter int `fixture:"GroupCounter"`
+}) (string, interface{}) {
+	return fmt.Sprintf("counter_%d", fixtures.Counter), nil
+}
+
+func (s GroupCounterLabelFixture) Destruct(t *testing.T, ctx interface{}) {}
+
+// session scoped fixture shared by all tests in the test binary
+type SessionDirFixture struct {
+	ConstructCount int
+}
+
+func (s *SessionDirFixture) Construct(t *testing.T, fixtures struct{}) (string, string) {
+	s.ConstructCount += 1
+	dir, err := ioutil.TempDir("", "gtest-session")
+	assert.NoError(t, err)
+	return dir, dir
+}
+
+func (s *SessionDirFixture) Destruct(t *testing.T, dir string) {
+	assert.NoError(t, os.RemoveAll(dir))
+}
+
+// fixture that can fail to construct and destruct
+type WorkFileFixture struct{}
+
+func (s WorkFileFixture) Construct(t *testing.T, fixtures struct {
+	Dir string `fixture:"TmpDir"`
+}) (string, string, error) {
+	path := fixtures.Dir + "/work"
+	err := ioutil.WriteFile(path, []byte("GTest"), 0644)
+	return path, path, err
+}
+
+func (s WorkFileFixture) Destruct(t *testing.T, path string) error {
+	return os.Remove(path)
+}
+
+// function fixture returning a cleanup closure instead of destruct context
+var funcTmpDirs []string
+
+func funcTmpDir(t *testing.T, fixtures struct {
+	Path string `fixture:"WorkFile"`
+}) (string, func()) {
+	dir, err := ioutil.TempDir("", "gtest-func")
+	assert.NoError(t, err)
+	funcTmpDirs = append(funcTmpDirs, dir)
+	return dir, func() { os.RemoveAll(dir) }
+}
+
 // register all fixtures
 func init() {
 	gtest.MustRegisterFixture("UserId", &UserIdFixture{}, gtest.ScopeCall)
@@ -134,6 +207,16 @@ func init() {
 	gtest.MustRegisterFixture("MockComment", &MockCommentFixture{}, gtest.ScopeCall)
 	gtest.MustRegisterFixture("TmpDir", &TmpDirFixture{}, gtest.ScopeSubTest)
 	gtest.MustRegisterFixture("MockApiServer", &MockApiServerFixture{}, gtest.ScopeSubTest)
+	gtest.MustRegisterFixture("GroupCounter", &GroupCounterFixture{}, gtest.ScopeGroup)
+	gtest.MustRegisterFixture("GroupCounterLabel", &GroupCounterLabelFixture{}, gtest.ScopeSubTest)
+	gtest.MustRegisterFixture("SessionDir", &SessionDirFixture{}, gtest.ScopeSession)
+	gtest.MustRegisterFixture("WorkFile", WorkFileFixture{}, gtest.ScopeSubTest)
+	gtest.MustRegisterFixtureFunc("FuncTmpDir", funcTmpDir, gtest.ScopeSubTest)
+}
+
+func TestMain(m *testing.M) {
+	// session scoped fixtures are destructed after all tests are completed
+	gtest.Main(m)
 }
 
 // start of tests
@@ -216,6 +299,15 @@ func (GTestTests) SubTestFixtureDestruct(t *testing.T, fixtures struct {
 	// goleak will report error is ApiServer fixture is not destructed properly
 }
 
+// Construct and Destruct can return error instead of failing the test directly
+func (GTestTests) SubTestErrorReturningFixture(t *testing.T, fixtures struct {
+	Path string `fixture:"WorkFile"`
+}) {
+	data, err := ioutil.ReadFile(fixtures.Path)
+	assert.NoError(t, err)
+	assert.Equal(t, "GTest", string(data))
+}
+
 func (s *GTestTests) SubTestSetupAndTearDown(t *testing.T) {
 	// s.Initialized will be checked again after RunSubTests returns in TestGTest
 	assert.True(t, s.Initialized)
@@ -243,6 +335,12 @@ func (InvalidFixtureConstructInput3) Construct(t int, fixtures struct{}) (string
 	return "", nil
 }
 
+type InvalidFixtureConstructInput4 struct{}
+
+func (InvalidFixtureConstructInput4) Construct(ctx context.Context, t *testing.T) (string, interface{}) {
+	return "", nil
+}
+
 type InvalidFixtureMissingDestruct struct{}
 
 func (InvalidFixtureMissingDestruct) Construct(t *testing.T, fixtures struct{}) (string, interface{}) {
@@ -270,6 +368,20 @@ func (InvalidFixtureDestructOutput2) Construct(t *testing.T, fixtures struct{})
 }
 func (InvalidFixtureDestructOutput2) Destruct(t *testing.T, ctx struct{}) {}
 
+type InvalidFixtureConstructOutput struct{}
+
+func (InvalidFixtureConstructOutput) Construct(t *testing.T, fixtures struct{}) (string, interface{}, string) {
+	return "", nil, ""
+}
+func (InvalidFixtureConstructOutput) Destruct(t *testing.T, ctx interface{}) {}
+
+type InvalidFixtureDestructOutput3 struct{}
+
+func (InvalidFixtureDestructOutput3) Construct(t *testing.T, fixtures struct{}) (string, interface{}) {
+	return "", nil
+}
+func (InvalidFixtureDestructOutput3) Destruct(t *testing.T, ctx interface{}) string { return "" }
+
 func (s *GTestTests) SubTestInvalidFixtureRegistration(t *testing.T) {
 	for _, entry := range []struct {
 		Name string
@@ -280,21 +392,72 @@ func (s *GTestTests) SubTestInvalidFixtureRegistration(t *testing.T) {
 		{"ConstructInput1", InvalidFixtureConstructInput1{}},
 		{"ConstructInput2", InvalidFixtureConstructInput2{}},
 		{"ConstructInput3", InvalidFixtureConstructInput3{}},
+		{"ConstructInput4", InvalidFixtureConstructInput4{}},
 		{"MissingDestruct", InvalidFixtureMissingDestruct{}},
 		{"DestructInput", InvalidFixtureDestructInput{}},
 		{"DestructOutput1", InvalidFixtureDestructOutput1{}},
 		{"DestructOutput2", InvalidFixtureDestructOutput2{}},
+		{"ConstructOutput", InvalidFixtureConstructOutput{}},
+		{"DestructOutput3", InvalidFixtureDestructOutput3{}},
 	} {
 		t.Run(entry.Name, func(t *testing.T) {
-			err := gtest.RegisterFixture("Foo", entry.F, gtest.ScopeCall)
+			err := gtest.NewRegistry().Register("Foo", entry.F, gtest.ScopeCall)
 			assert.Error(t, err)
 		})
 	}
 }
 
+// group scoped fixtures cannot depend on narrower scoped fixtures
+type GroupDirFixture struct{}
+
+func (s GroupDirFixture) Construct(t *testing.T, fixtures struct {
+	Dir string `fixture:"TmpDir"`
+}) (string, interface{}) {
+	return fixtures.Dir, nil
+}
+
+func (s GroupDirFixture) Destruct(t *testing.T, ctx interface{}) {}
+
+// depends on a fixture that's never registered with a valid scope
+type GroupLateDirFixture struct{}
+
+func (s GroupLateDirFixture) Construct(t *testing.T, fixtures struct {
+	Dir string `fixture:"LateDir"`
+}) (string, interface{}) {
+	return fixtures.Dir, nil
+}
+
+func (s GroupLateDirFixture) Destruct(t *testing.T, ctx interface{}) {}
+
+func (s *GTestTests) SubTestFixtureScopeMismatchReg(t *testing.T) {
+	reg := gtest.DefaultRegistry.Clone()
+	err := reg.Register("GroupDir", GroupDirFixture{}, gtest.ScopeGroup)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "ScopeMismatch")
+	assert.Contains(t, err.Error(), "'GroupDir'")
+	assert.Contains(t, err.Error(), "'TmpDir'")
+
+	// registration order doesn't matter
+	reg.MustRegister("GroupLateDir", GroupLateDirFixture{}, gtest.ScopeGroup)
+	err = reg.Register("LateDir", TmpDirFixture{}, gtest.ScopeSubTest)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "'GroupLateDir'")
+	assert.Contains(t, err.Error(), "'LateDir'")
+
+	err = reg.Register("GroupDir", GroupDirFixture{}, gtest.FixtureScope("bogus"))
+	assert.Error(t, err)
+}
+
 func (s *GTestTests) SubTestFixtureDuplicatedReg(t *testing.T) {
 	err := gtest.RegisterFixture("UserId", &UserIdFixture{}, gtest.ScopeSubTest)
 	assert.Error(t, err)
+
+	reg := gtest.NewRegistry()
+	assert.NoError(t, reg.Register("UserId", &UserIdFixture{}, gtest.ScopeSubTest))
+	assert.Error(t, reg.Register("UserId", &UserIdFixture{}, gtest.ScopeSubTest))
+	assert.True(t, reg.Unregister("UserId"))
+	assert.False(t, reg.Unregister("UserId"))
+	assert.NoError(t, reg.Register("UserId", &UserIdFixture{}, gtest.ScopeSubTest))
 }
 
 func TestGTest(t *testing.T) {
@@ -313,3 +476,1347 @@ func TestGTest(t *testing.T) {
 	// test Teardown method
 	assert.False(t, testGroup.Initialized)
 }
+
+type GroupScopeTests struct {
+	Counter *GroupCounterFixture
+	// counter value observed by the first subtest
+	FirstCounter int
+	// allocated count observed in Teardown
+	AllocatedInTeardown int
+}
+
+func (s *GroupScopeTests) Setup(t *testing.T)      {}
+func (s *GroupScopeTests) BeforeEach(t *testing.T) {}
+func (s *GroupScopeTests) AfterEach(t *testing.T)  {}
+
+func (s *GroupScopeTests) Teardown(t *testing.T) {
+	s.AllocatedInTeardown = s.Counter.AllocatedCount
+}
+
+// group scoped fixture is only constructed once for all subtests in a group
+func (s *GroupScopeTests) SubTestFirst(t *testing.T, fixtures struct {
+	Counter1 int `fixture:"GroupCounter"`
+	Counter2 int `fixture:"GroupCounter"`
+}) {
+	assert.Equal(t, fixtures.Counter1, fixtures.Counter2)
+	s.FirstCounter = fixtures.Counter1
+}
+
+func (s *GroupScopeTests) SubTestSecond(t *testing.T, fixtures struct {
+	Counter int    `fixture:"GroupCounter"`
+	Label   string `fixture:"GroupCounterLabel"`
+}) {
+	assert.Equal(t, s.FirstCounter, fixtures.Counter)
+	assert.Equal(t, fmt.Sprintf("counter_%d", fixtures.Counter), fixtures.Label)
+}
+
+func TestGroupScopedFixture(t *testing.T) {
+	entry, _ := gtest.GetFixture("GroupCounter")
+	counter := entry.Instance.(*GroupCounterFixture)
+	counter.ConstructCount = 0
+
+	testGroup := &GroupScopeTests{Counter: counter}
+	gtest.RunSubTests(t, testGroup)
+	assert.Equal(t, 1, counter.ConstructCount)
+	// group scoped fixture should still be alive during Teardown
+	assert.Equal(t, 1, testGroup.AllocatedInTeardown)
+	assert.Equal(t, 0, counter.AllocatedCount)
+
+	// each RunSubTests call gets a fresh group scoped fixture value
+	gtest.RunSubTests(t, &GroupScopeTests{Counter: counter})
+	assert.Equal(t, 2, counter.ConstructCount)
+	assert.Equal(t, 0, counter.AllocatedCount)
+}
+
+type SessionScopeTests struct{}
+
+func (s *SessionScopeTests) Setup(t *testing.T)      {}
+func (s *SessionScopeTests) Teardown(t *testing.T)   {}
+func (s *SessionScopeTests) BeforeEach(t *testing.T) {}
+func (s *SessionScopeTests) AfterEach(t *testing.T)  {}
+
+func (s *SessionScopeTests) SubTestDir(t *testing.T, fixtures struct {
+	Dir1 string `fixture:"SessionDir"`
+	Dir2 string `fixture:"TmpDir"`
+}) {
+	assert.NotEqual(t, fixtures.Dir1, fixtures.Dir2)
+
+	info, err := os.Stat(fixtures.Dir1)
+	assert.NoError(t, err)
+	assert.True(t, info.IsDir())
+}
+
+func TestSessionScopedFixture(t *testing.T) {
+	entry, _ := gtest.GetFixture("SessionDir")
+	dir := entry.Instance.(*SessionDirFixture)
+
+	// session scoped fixture is shared across RunSubTests calls
+	gtest.RunSubTests(t, &SessionScopeTests{})
+	gtest.RunSubTests(t, &SessionScopeTests{})
+	assert.Equal(t, 1, dir.ConstructCount)
+}
+
+// session scoped fixture failing to destruct
+type BrokenSessionFixture struct{}
+
+func (s BrokenSessionFixture) Construct(t *testing.T, fixtures struct{}) (string, interface{}) {
+	return "broken", nil
+}
+
+func (s BrokenSessionFixture) Destruct(t *testing.T, ctx interface{}) error {
+	return fmt.Errorf("disk full")
+}
+
+type BrokenSessionTests struct{}
+
+func (s *BrokenSessionTests) SubTestBroken(t *testing.T, fixtures struct {
+	Broken string `fixture:"BrokenSession"`
+}) {
+}
+
+// session fixture Destruct failures are reported after all tests are run
+func TestBrokenSessionFixture(t *testing.T) {
+	stdout, stderr, err := gtest.RunHelperTest(t, "TestBrokenSessionHelper")
+	exitErr, ok := err.(*exec.ExitError)
+	assert.True(t, ok)
+	if ok {
+		assert.Equal(t, 1, exitErr.ExitCode())
+	}
+	assert.Contains(t, stdout, "--- PASS: TestBrokenSessionHelper")
+	assert.NotContains(t, stdout, "GTestSessionTeardown")
+	assert.Contains(t, stderr, "gtest: failed to destruct session fixtures:")
+	assert.Contains(t, stderr, "Fixture 'BrokenSession' Destruct failed: disk full")
+	assert.NotContains(t, stderr, "GTestSessionTeardown")
+}
+
+func TestBrokenSessionHelper(t *testing.T) {
+	gtest.SkipUnlessHelper(t)
+	reg := gtest.NewRegistry()
+	reg.MustRegister("BrokenSession", BrokenSessionFixture{}, gtest.ScopeSession)
+	gtest.RunSubTests(t, &BrokenSessionTests{}, gtest.WithRegistry(reg))
+}
+
+// fixtures recording their destruct order
+var destructLog []string
+
+type OrderInnerFixture struct{}
+
+func (s OrderInnerFixture) Construct(t *testing.T, fixtures struct{}) (string, interface{}) {
+	return "inner", nil
+}
+
+func (s OrderInnerFixture) Destruct(t *testing.T, ctx interface{}) {
+	destructLog = append(destructLog, "OrderInner")
+}
+
+type OrderOuterFixture struct{}
+
+func (s OrderOuterFixture) Construct(t *testing.T, fixtures struct {
+	Inner string `fixture:"OrderInner"`
+}) (string, interface{}) {
+	return "outer_" + fixtures.Inner, nil
+}
+
+func (s OrderOuterFixture) Destruct(t *testing.T, ctx interface{}) {
+	destructLog = append(destructLog, "OrderOuter")
+}
+
+func init() {
+	gtest.MustRegisterFixture("OrderInner", OrderInnerFixture{}, gtest.ScopeSubTest)
+	gtest.MustRegisterFixture("OrderOuter", OrderOuterFixture{}, gtest.ScopeSubTest)
+}
+
+type DestructOrderTests struct{}
+
+func (s *DestructOrderTests) Setup(t *testing.T)      {}
+func (s *DestructOrderTests) Teardown(t *testing.T)   {}
+func (s *DestructOrderTests) BeforeEach(t *testing.T) {}
+
+func (s *DestructOrderTests) AfterEach(t *testing.T) {
+	destructLog = append(destructLog, "AfterEach")
+}
+
+// fixtures are destructed before fixtures they depend on
+func (s *DestructOrderTests) SubTestOrder(t *testing.T, fixtures struct {
+	Outer string `fixture:"OrderOuter"`
+}) {
+	assert.Equal(t, "outer_inner", fixtures.Outer)
+}
+
+// fixtures are destructed even if subtest exits with runtime.Goexit
+func (s *DestructOrderTests) SubTestSkipNow(t *testing.T, fixtures struct {
+	Outer string `fixture:"OrderOuter"`
+}) {
+	t.SkipNow()
+}
+
+func TestFixtureDestructOrder(t *testing.T) {
+	destructLog = nil
+	gtest.RunSubTests(t, &DestructOrderTests{})
+	assert.Equal(t, []string{
+		"OrderOuter", "OrderInner", "AfterEach",
+		"OrderOuter", "OrderInner", "AfterEach",
+	}, destructLog)
+}
+
+// fixture panicking in Destruct
+type OrderPanicFixture struct{}
+
+func (s OrderPanicFixture) Construct(t *testing.T, fixtures struct{}) (string, interface{}) {
+	return "panic", nil
+}
+
+func (s OrderPanicFixture) Destruct(t *testing.T, ctx interface{}) {
+	destructLog = append(destructLog, "OrderPanic")
+	panic("boom")
+}
+
+type PanicDestructTests struct{}
+
+func (s *PanicDestructTests) AfterEach(t *testing.T) {
+	destructLog = append(destructLog, "AfterEach")
+}
+
+func (s *PanicDestructTests) SubTestPanic(t *testing.T, fixtures struct {
+	Outer string `fixture:"OrderOuter"`
+	Panic string `fixture:"OrderPanic"`
+}) {
+}
+
+// panicking Destruct fails the subtest without skipping remaining Destructs
+// and AfterEach
+func TestFixtureDestructPanic(t *testing.T) {
+	stdout, _, err := gtest.RunHelperTest(t, "TestFixtureDestructPanicHelper")
+	assert.Error(t, err)
+	assert.Contains(t, stdout, "Fixture 'OrderPanic' Destruct panicked: boom")
+	assert.Contains(t, stdout, "--- FAIL: TestFixtureDestructPanicHelper/Panic")
+	assert.Contains(t, stdout, "destruct log: OrderPanic,OrderOuter,OrderInner,AfterEach\n")
+}
+
+func TestFixtureDestructPanicHelper(t *testing.T) {
+	gtest.SkipUnlessHelper(t)
+	reg := gtest.DefaultRegistry.Clone()
+	reg.MustRegister("OrderPanic", OrderPanicFixture{}, gtest.ScopeSubTest)
+	destructLog = nil
+	gtest.RunSubTests(t, &PanicDestructTests{}, gtest.WithRegistry(reg))
+	fmt.Printf("destruct log: %s\n", strings.Join(destructLog, ","))
+}
+
+// records lifecycle hook calls of a test group
+type LifecycleTests struct {
+	SkipSetup      bool
+	SkipBeforeEach bool
+	Calls          []string
+}
+
+func (s *LifecycleTests) Setup(t *testing.T) {
+	s.Calls = append(s.Calls, "Setup")
+	if s.SkipSetup {
+		t.SkipNow()
+	}
+}
+
+func (s *LifecycleTests) Teardown(t *testing.T) {
+	s.Calls = append(s.Calls, "Teardown")
+}
+
+func (s *LifecycleTests) BeforeEach(t *testing.T) {
+	s.Calls = append(s.Calls, "BeforeEach")
+	if s.SkipBeforeEach {
+		t.SkipNow()
+	}
+}
+
+func (s *LifecycleTests) AfterEach(t *testing.T) {
+	s.Calls = append(s.Calls, "AfterEach")
+}
+
+func (s *LifecycleTests) SubTestBody(t *testing.T) {
+	s.Calls = append(s.Calls, "Body")
+}
+
+func TestLifecycle(t *testing.T) {
+	testGroup := &LifecycleTests{}
+	gtest.RunSubTests(t, testGroup)
+	assert.Equal(t, []string{"Setup", "BeforeEach", "Body", "AfterEach", "Teardown"}, testGroup.Calls)
+}
+
+func TestLifecycleSetupExit(t *testing.T) {
+	testGroup := &LifecycleTests{SkipSetup: true}
+	t.Run("Group", func(t *testing.T) {
+		gtest.RunSubTests(t, testGroup)
+	})
+	// subtests are skipped but Teardown is still called
+	assert.Equal(t, []string{"Setup", "Teardown"}, testGroup.Calls)
+}
+
+func TestLifecycleBeforeEachExit(t *testing.T) {
+	testGroup := &LifecycleTests{SkipBeforeEach: true}
+	gtest.RunSubTests(t, testGroup)
+	// test body is skipped but AfterEach is still called
+	assert.Equal(t, []string{"Setup", "BeforeEach", "AfterEach", "Teardown"}, testGroup.Calls)
+}
+
+// context aware fixture, context is cancelled when owning scope ends
+type ContextFixture struct {
+	Constructed []context.Context
+}
+
+func (s *ContextFixture) Construct(ctx context.Context, t *testing.T, fixtures struct{}) (context.Context, interface{}) {
+	assert.NoError(t, ctx.Err())
+	_, ok := ctx.Deadline()
+	assert.True(t, ok)
+	s.Constructed = append(s.Constructed, ctx)
+	return ctx, nil
+}
+
+func (s *ContextFixture) Destruct(ctx context.Context, t *testing.T, c interface{}) {
+	// context is still valid during Destruct
+	assert.NoError(t, ctx.Err())
+}
+
+func init() {
+	gtest.MustRegisterFixture(
+		"Context", &ContextFixture{}, gtest.ScopeSubTest, gtest.WithConstructTimeout(5*time.Second))
+}
+
+type ContextTests struct{}
+
+func (s *ContextTests) Setup(t *testing.T)      {}
+func (s *ContextTests) Teardown(t *testing.T)   {}
+func (s *ContextTests) BeforeEach(t *testing.T) {}
+func (s *ContextTests) AfterEach(t *testing.T)  {}
+
+func (s *ContextTests) SubTestContext(t *testing.T, fixtures struct {
+	Ctx context.Context `fixture:"Context"`
+}) {
+	assert.NoError(t, fixtures.Ctx.Err())
+}
+
+func TestContextFixture(t *testing.T) {
+	entry, _ := gtest.GetFixture("Context")
+	fixture := entry.Instance.(*ContextFixture)
+	fixture.Constructed = nil
+
+	gtest.RunSubTests(t, &ContextTests{})
+	assert.Len(t, fixture.Constructed, 1)
+	assert.Error(t, fixture.Constructed[0].Err())
+	assert.Equal(t, 5*time.Second, entry.ConstructTimeout)
+}
+
+type RegistryTests struct{}
+
+func (s *RegistryTests) Setup(t *testing.T)      {}
+func (s *RegistryTests) Teardown(t *testing.T)   {}
+func (s *RegistryTests) BeforeEach(t *testing.T) {}
+func (s *RegistryTests) AfterEach(t *testing.T)  {}
+
+// UserId is overridden in custom registry, WorkDir is inherited from
+// DefaultRegistry
+func (s *RegistryTests) SubTestCustomRegistry(t *testing.T, fixtures struct {
+	Uid int    `fixture:"UserId"`
+	Dir string `fixture:"WorkDir"`
+}) {
+	assert.Equal(t, 1, fixtures.Uid)
+	assert.NotEmpty(t, fixtures.Dir)
+}
+
+func TestRegistry(t *testing.T) {
+	reg := gtest.DefaultRegistry.Clone()
+	assert.True(t, reg.Unregister("UserId"))
+	reg.MustRegister("UserId", &UidFixture{}, gtest.ScopeCall)
+
+	// DefaultRegistry is not affected by changes to cloned registry
+	entry, ok := gtest.GetFixture("UserId")
+	assert.True(t, ok)
+	_, ok = entry.Instance.(*UserIdFixture)
+	assert.True(t, ok)
+
+	gtest.RunSubTests(t, &RegistryTests{}, gtest.WithRegistry(reg))
+}
+
+type ClonedSessionTests struct {
+	Sess string
+}
+
+func (s *ClonedSessionTests) SubTestSession(t *testing.T, fixtures struct {
+	Sess string `fixture:"ClonedSession"`
+}) {
+	s.Sess = fixtures.Sess
+}
+
+// session fixture is cached per registry, so it's built from dependencies
+// registered in the registry it's resolved from
+func TestClonedRegistrySessionFixture(t *testing.T) {
+	reg := gtest.NewRegistry()
+	reg.MustRegisterFunc("ClonedSession", func(t *testing.T, fixtures struct {
+		Dep string `fixture:"ClonedDep"`
+	}) (string, func()) {
+		return "sess:" + fixtures.Dep, nil
+	}, gtest.ScopeSession)
+	reg.MustRegisterFunc("ClonedDep", func(t *testing.T, fixtures struct{}) (string, func()) {
+		return "default-dep", nil
+	}, gtest.ScopeSession)
+
+	clone := reg.Clone()
+	assert.True(t, clone.Unregister("ClonedDep"))
+	clone.MustRegisterFunc("ClonedDep", func(t *testing.T, fixtures struct{}) (string, func()) {
+		return "clone-dep", nil
+	}, gtest.ScopeSession)
+
+	group := &ClonedSessionTests{}
+	gtest.RunSubTests(t, group, gtest.WithRegistry(reg))
+	assert.Equal(t, "sess:default-dep", group.Sess)
+	gtest.RunSubTests(t, group, gtest.WithRegistry(clone))
+	assert.Equal(t, "sess:clone-dep", group.Sess)
+}
+
+type FuncFixtureTests struct{}
+
+func (s *FuncFixtureTests) Setup(t *testing.T)      {}
+func (s *FuncFixtureTests) Teardown(t *testing.T)   {}
+func (s *FuncFixtureTests) BeforeEach(t *testing.T) {}
+func (s *FuncFixtureTests) AfterEach(t *testing.T)  {}
+
+func (s *FuncFixtureTests) SubTestFuncFixture(t *testing.T, fixtures struct {
+	Dir1 string `fixture:"FuncTmpDir"`
+	Dir2 string `fixture:"FuncTmpDir"`
+}) {
+	assert.Equal(t, fixtures.Dir1, fixtures.Dir2)
+
+	info, err := os.Stat(fixtures.Dir1)
+	assert.NoError(t, err)
+	assert.True(t, info.IsDir())
+}
+
+func TestFuncFixture(t *testing.T) {
+	funcTmpDirs = nil
+	gtest.RunSubTests(t, &FuncFixtureTests{})
+
+	assert.Len(t, funcTmpDirs, 1)
+	_, err := os.Stat(funcTmpDirs[0])
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestInvalidFuncFixtureRegistration(t *testing.T) {
+	for _, entry := range []struct {
+		Name string
+		Fn   interface{}
+	}{
+		{"NotFunc", TmpDirFixture{}},
+		{"Input", func(t *testing.T) (string, func()) { return "", nil }},
+		{"Input1", func(t int, fixtures struct{}) (string, func()) { return "", nil }},
+		{"Input2", func(t *testing.T, fixtures string) (string, func()) { return "", nil }},
+		{"Output", func(t *testing.T, fixtures struct{}) string { return "" }},
+		{"Output1", func(t *testing.T, fixtures struct{}) (string, string) { return "", "" }},
+		{"Output2", func(t *testing.T, fixtures struct{}) (string, func(), string) { return "", nil, "" }},
+	} {
+		t.Run(entry.Name, func(t *testing.T) {
+			err := gtest.NewRegistry().RegisterFunc("Foo", entry.Fn, gtest.ScopeCall)
+			assert.Error(t, err)
+		})
+	}
+
+	reg := gtest.NewRegistry()
+	assert.NoError(t, reg.RegisterFunc("Foo", func(
+		ctx context.Context, t *testing.T, fixtures struct{},
+	) (string, func(), error) {
+		return "", nil, nil
+	}, gtest.ScopeCall))
+}
+
+type BackendFixture struct{}
+
+func (s BackendFixture) Params() []interface{} {
+	return []interface{}{"sqlite", "memory"}
+}
+
+func (s BackendFixture) Construct(t *testing.T, fixtures struct{}) (string, interface{}) {
+	return gtest.Param(t).(string), nil
+}
+
+func (s BackendFixture) Destruct(t *testing.T, ctx interface{}) {}
+
+type StoreFixture struct{}
+
+func (s StoreFixture) Construct(t *testing.T, fixtures struct {
+	Backend string `fixture:"Backend"`
+}) (string, interface{}) {
+	return "store-" + fixtures.Backend, nil
+}
+
+func (s StoreFixture) Destruct(t *testing.T, ctx interface{}) {}
+
+func init() {
+	gtest.MustRegisterFixture("Backend", BackendFixture{}, gtest.ScopeGroup)
+	gtest.MustRegisterFixture("Store", StoreFixture{}, gtest.ScopeGroup)
+	gtest.MustRegisterFixtureFunc("BatchSize", func(t *testing.T, fixtures struct{}) (int, func()) {
+		return gtest.Param(t).(int), nil
+	}, gtest.ScopeCall, gtest.WithParams(1, 10))
+}
+
+type ParamTests struct {
+	Runs []string
+}
+
+func (s *ParamTests) Setup(t *testing.T)      {}
+func (s *ParamTests) Teardown(t *testing.T)   {}
+func (s *ParamTests) BeforeEach(t *testing.T) {}
+func (s *ParamTests) AfterEach(t *testing.T)  {}
+
+func (s *ParamTests) SubTestBackend(t *testing.T, fixtures struct {
+	Backend string `fixture:"Backend"`
+}) {
+	assert.True(t, strings.HasSuffix(t.Name(), "/Backend/"+fixtures.Backend))
+	s.Runs = append(s.Runs, "Backend:"+fixtures.Backend)
+}
+
+// Store is group scoped, but still constructed once per Backend parameter
+func (s *ParamTests) SubTestStore(t *testing.T, fixtures struct {
+	Store string `fixture:"Store"`
+}) {
+	s.Runs = append(s.Runs, "Store:"+fixtures.Store)
+}
+
+func (s *ParamTests) SubTestCombo(t *testing.T, fixtures struct {
+	Backend string `fixture:"Backend"`
+	Size    int    `fixture:"BatchSize"`
+}) {
+	s.Runs = append(s.Runs, fmt.Sprintf("Combo:%s-%d", fixtures.Backend, fixtures.Size))
+}
+
+func (s *ParamTests) SubTestNoParams(t *testing.T) {
+	assert.True(t, strings.HasSuffix(t.Name(), "/NoParams"))
+	assert.Nil(t, gtest.Param(t))
+	s.Runs = append(s.Runs, "NoParams")
+}
+
+func TestParametrizedFixture(t *testing.T) {
+	testGroup := &ParamTests{}
+	gtest.RunSubTests(t, testGroup)
+
+	assert.Equal(t, []string{
+		"Backend:sqlite",
+		"Backend:memory",
+		"Combo:sqlite-1",
+		"Combo:sqlite-10",
+		"Combo:memory-1",
+		"Combo:memory-10",
+		"NoParams",
+		"Store:store-sqlite",
+		"Store:store-memory",
+	}, testGroup.Runs)
+}
+
+type PrefixCase struct {
+	Name   string
+	Input  string
+	Prefix string
+}
+
+type ExitCode int
+
+func (c ExitCode) String() string {
+	return fmt.Sprintf("exit%d", int(c))
+}
+
+type CaseTests struct {
+	Runs []string
+	Dirs map[string]bool
+}
+
+func (s *CaseTests) Setup(t *testing.T)      {}
+func (s *CaseTests) Teardown(t *testing.T)   {}
+func (s *CaseTests) BeforeEach(t *testing.T) {}
+func (s *CaseTests) AfterEach(t *testing.T)  {}
+
+func (s *CaseTests) CasesPrefix() []PrefixCase {
+	return []PrefixCase{
+		{Name: "Short", Input: "abc", Prefix: "a"},
+		{Name: "Long", Input: "abcdef", Prefix: "abcd"},
+		{Input: "xyz", Prefix: "x"},
+	}
+}
+
+// fixtures are resolved for each test case
+func (s *CaseTests) SubTestPrefix(t *testing.T, fixtures struct {
+	Dir string `fixture:"WorkDir"`
+}, tc PrefixCase) {
+	assert.True(t, strings.HasPrefix(tc.Input, tc.Prefix))
+	s.Runs = append(s.Runs, t.Name())
+	s.Dirs[fixtures.Dir] = true
+}
+
+type PointerCase struct {
+	Id int
+}
+
+func (c *PointerCase) String() string {
+	return fmt.Sprintf("case%d", c.Id)
+}
+
+// nil cases are named after their index
+func (s *CaseTests) CasesPointer() []*PointerCase {
+	return []*PointerCase{{Id: 1}, nil}
+}
+
+func (s *CaseTests) SubTestPointer(t *testing.T, tc *PointerCase) {
+	s.Runs = append(s.Runs, t.Name())
+}
+
+func (s *CaseTests) CasesExitCode() []ExitCode {
+	return []ExitCode{0, 1}
+}
+
+func (s *CaseTests) SubTestExitCode(t *testing.T, tc ExitCode) {
+	s.Runs = append(s.Runs, t.Name())
+}
+
+func TestSubTestCases(t *testing.T) {
+	testGroup := &CaseTests{Dirs: map[string]bool{}}
+	gtest.RunSubTests(t, testGroup)
+
+	assert.Len(t, testGroup.Dirs, 3)
+	assert.Equal(t, []string{
+		"TestSubTestCases/ExitCode/exit0",
+		"TestSubTestCases/ExitCode/exit1",
+		"TestSubTestCases/Pointer/case1",
+		"TestSubTestCases/Pointer/1",
+		"TestSubTestCases/Prefix/Short",
+		"TestSubTestCases/Prefix/Long",
+		"TestSubTestCases/Prefix/2",
+	}, testGroup.Runs)
+}
+
+type ParallelTests struct {
+	finished  int32
+	Teardowns int32
+	// Finished records number of finished subtests at Teardown
+	Finished int32
+}
+
+func (s *ParallelTests) Setup(t *testing.T) {}
+
+func (s *ParallelTests) Teardown(t *testing.T) {
+	atomic.AddInt32(&s.Teardowns, 1)
+	s.Finished = atomic.LoadInt32(&s.finished)
+}
+
+func (s *ParallelTests) BeforeEach(t *testing.T) {}
+func (s *ParallelTests) AfterEach(t *testing.T)  {}
+
+func (s *ParallelTests) run(t *testing.T, counter int) {
+	// group fixture is constructed once even if requested concurrently
+	assert.Equal(t, 1, counter)
+	atomic.AddInt32(&s.finished, 1)
+}
+
+func (s *ParallelTests) SubTestFirst(t *testing.T, fixtures struct {
+	Counter int    `fixture:"SlowGroupCounter"`
+	Uid     string `fixture:"UserId"`
+}) {
+	s.run(t, fixtures.Counter)
+}
+
+func (s *ParallelTests) SubTestSecond(t *testing.T, fixtures struct {
+	Counter int    `fixture:"SlowGroupCounter"`
+	Uid     string `fixture:"UserId"`
+}) {
+	s.run(t, fixtures.Counter)
+}
+
+func (s *ParallelTests) SubTestThird(t *testing.T, fixtures struct {
+	Counter int    `fixture:"SlowGroupCounter"`
+	Uid     string `fixture:"UserId"`
+}) {
+	s.run(t, fixtures.Counter)
+}
+
+func TestParallel(t *testing.T) {
+	var constructed int32
+	reg := gtest.DefaultRegistry.Clone()
+	reg.MustRegisterFunc("SlowGroupCounter", func(t *testing.T, fixtures struct{}) (int, func()) {
+		n := atomic.AddInt32(&constructed, 1)
+		time.Sleep(10 * time.Millisecond)
+		return int(n), nil
+	}, gtest.ScopeGroup)
+
+	testGroup := &ParallelTests{}
+	t.Run("Group", func(t *testing.T) {
+		gtest.RunSubTests(t, testGroup, gtest.WithRegistry(reg), gtest.WithParallel())
+		// parallel subtests only start after RunSubTests returns
+		assert.Equal(t, int32(0), atomic.LoadInt32(&testGroup.finished))
+		assert.Equal(t, int32(0), testGroup.Teardowns)
+	})
+
+	assert.Equal(t, int32(1), constructed)
+	assert.Equal(t, int32(1), testGroup.Teardowns)
+	assert.Equal(t, int32(3), testGroup.Finished)
+}
+
+// fixture registered by value, which can't be used as map key
+type SliceFixture struct {
+	Names []string
+}
+
+func (s SliceFixture) Construct(t *testing.T, fixtures struct{}) ([]string, interface{}) {
+	return s.Names, nil
+}
+
+func (s SliceFixture) Destruct(t *testing.T, ctx interface{}) {}
+
+type SliceFixtureTests struct{}
+
+func (s *SliceFixtureTests) SubTestNames(t *testing.T, fixtures struct {
+	Call     []string `fixture:"SliceCall"`
+	SubTest  []string `fixture:"SliceSubTest"`
+	SubTest2 []string `fixture:"SliceSubTest"`
+}) {
+	assert.Equal(t, []string{"a"}, fixtures.Call)
+	assert.Equal(t, []string{"b"}, fixtures.SubTest)
+	assert.Equal(t, []string{"b"}, fixtures.SubTest2)
+}
+
+func TestUncomparableFixture(t *testing.T) {
+	reg := gtest.NewRegistry()
+	reg.MustRegister("SliceCall", SliceFixture{Names: []string{"a"}}, gtest.ScopeCall)
+	reg.MustRegister("SliceSubTest", SliceFixture{Names: []string{"b"}}, gtest.ScopeSubTest)
+	gtest.RunSubTests(t, &SliceFixtureTests{}, gtest.WithRegistry(reg))
+}
+
+type AutouseTests struct {
+	Log []string
+}
+
+func (s *AutouseTests) Setup(t *testing.T)      {}
+func (s *AutouseTests) Teardown(t *testing.T)   {}
+func (s *AutouseTests) BeforeEach(t *testing.T) {}
+func (s *AutouseTests) AfterEach(t *testing.T)  {}
+
+func (s *AutouseTests) AutoFixtures() []string {
+	return []string{"GroupAutoLog"}
+}
+
+func (s *AutouseTests) SubTestNoFixtures(t *testing.T) {
+	s.Log = append(s.Log, "body")
+}
+
+func (s *AutouseTests) SubTestFixtures(t *testing.T, fixtures struct {
+	Dir string `fixture:"WorkDir"`
+}) {
+	s.Log = append(s.Log, "body")
+}
+
+func TestAutouseFixture(t *testing.T) {
+	testGroup := &AutouseTests{}
+	logFixture := func(name string) func(t *testing.T, fixtures struct{}) (string, func()) {
+		return func(t *testing.T, fixtures struct{}) (string, func()) {
+			testGroup.Log = append(testGroup.Log, "construct "+name)
+			return name, func() {
+				testGroup.Log = append(testGroup.Log, "destruct "+name)
+			}
+		}
+	}
+	reg := gtest.DefaultRegistry.Clone()
+	reg.MustRegisterFunc("RegistryAutoLog", logFixture("registry"), gtest.ScopeSubTest, gtest.WithAutouse())
+	reg.MustRegisterFunc("GroupAutoLog", logFixture("group"), gtest.ScopeSubTest)
+
+	gtest.RunSubTests(t, testGroup, gtest.WithRegistry(reg))
+
+	subTestLog := []string{
+		"construct registry",
+		"construct group",
+		"body",
+		"destruct group",
+		"destruct registry",
+	}
+	assert.Equal(t, append(subTestLog, subTestLog...), testGroup.Log)
+}
+
+type HookFixtureTests struct {
+	SetupCounter    int
+	TeardownCounter int
+	BeforeEachDir   string
+	AfterEachDirs   []string
+}
+
+func (s *HookFixtureTests) Setup(t *testing.T, fixtures struct {
+	Counter int `fixture:"GroupCounter"`
+}) {
+	s.SetupCounter = fixtures.Counter
+}
+
+func (s *HookFixtureTests) Teardown(t *testing.T, fixtures struct {
+	Counter int `fixture:"GroupCounter"`
+}) {
+	s.TeardownCounter = fixtures.Counter
+}
+
+func (s *HookFixtureTests) BeforeEach(t *testing.T, fixtures struct {
+	Dir string `fixture:"TmpDir"`
+}) {
+	s.BeforeEachDir = fixtures.Dir
+}
+
+// AfterEach taking fixtures is called before fixtures are destructed
+func (s *HookFixtureTests) AfterEach(t *testing.T, fixtures struct {
+	Dir string `fixture:"TmpDir"`
+}) {
+	_, err := os.Stat(fixtures.Dir)
+	assert.NoError(t, err)
+	s.AfterEachDirs = append(s.AfterEachDirs, fixtures.Dir)
+}
+
+func (s *HookFixtureTests) SubTestShared(t *testing.T, fixtures struct {
+	Counter int    `fixture:"GroupCounter"`
+	Dir     string `fixture:"TmpDir"`
+}) {
+	assert.Equal(t, s.SetupCounter, fixtures.Counter)
+	assert.Equal(t, s.BeforeEachDir, fixtures.Dir)
+}
+
+func TestHookFixtures(t *testing.T) {
+	testGroup := &HookFixtureTests{}
+	gtest.RunSubTests(t, testGroup)
+
+	assert.NotZero(t, testGroup.SetupCounter)
+	assert.Equal(t, testGroup.SetupCounter, testGroup.TeardownCounter)
+	assert.Equal(t, []string{testGroup.BeforeEachDir}, testGroup.AfterEachDirs)
+}
+
+// test group without any hooks
+type NoHookTests struct {
+	Calls int
+}
+
+func (s *NoHookTests) SubTestBody(t *testing.T) {
+	s.Calls += 1
+}
+
+func TestOptionalHooks(t *testing.T) {
+	testGroup := &NoHookTests{}
+	gtest.RunSubTests(t, testGroup)
+	assert.Equal(t, 1, testGroup.Calls)
+}
+
+// hooks returning error
+type ErrorHookTests struct {
+	SetupErr      error
+	BeforeEachErr error
+	Calls         []string
+}
+
+func (s *ErrorHookTests) Setup(t *testing.T) error {
+	s.Calls = append(s.Calls, "Setup")
+	return s.SetupErr
+}
+
+func (s *ErrorHookTests) BeforeEach(t *testing.T) error {
+	s.Calls = append(s.Calls, "BeforeEach")
+	return s.BeforeEachErr
+}
+
+func (s *ErrorHookTests) AfterEach(t *testing.T) error {
+	s.Calls = append(s.Calls, "AfterEach")
+	return nil
+}
+
+func (s *ErrorHookTests) SubTestBody(t *testing.T) {
+	s.Calls = append(s.Calls, "Body")
+}
+
+func TestErrorReturningHooks(t *testing.T) {
+	var _ gtest.SetupGroupE = &ErrorHookTests{}
+	var _ gtest.BeforeEacherE = &ErrorHookTests{}
+	var _ gtest.AfterEacherE = &ErrorHookTests{}
+
+	testGroup := &ErrorHookTests{}
+	gtest.RunSubTests(t, testGroup)
+	assert.Equal(t, []string{"Setup", "BeforeEach", "Body", "AfterEach"}, testGroup.Calls)
+}
+
+type OuterGroupTests struct {
+	Log        []string
+	Counter    int
+	GroupCalls []string
+
+	// nested group as field
+	GroupField *InnerGroupTests
+	// fields with Group prefix not holding a test group are not run
+	GroupConfig OuterGroupConfig
+}
+
+// OuterGroupConfig has a Setup method that is not a hook
+type OuterGroupConfig struct {
+	Name string
+}
+
+func (c *OuterGroupConfig) Setup(name string) {
+	c.Name = name
+}
+
+func (s *OuterGroupTests) Setup(t *testing.T, fixtures struct {
+	Counter int `fixture:"GroupCounter"`
+}) {
+	s.Counter = fixtures.Counter
+	s.Log = append(s.Log, "outer Setup")
+}
+
+func (s *OuterGroupTests) Teardown(t *testing.T) {
+	s.Log = append(s.Log, "outer Teardown")
+}
+
+func (s *OuterGroupTests) BeforeEach(t *testing.T) {
+	s.Log = append(s.Log, "outer BeforeEach")
+}
+
+func (s *OuterGroupTests) AfterEach(t *testing.T) {
+	s.Log = append(s.Log, "outer AfterEach")
+}
+
+func (s *OuterGroupTests) SubTestOuter(t *testing.T) {
+	s.Log = append(s.Log, "Outer")
+}
+
+// nested group as method
+func (s *OuterGroupTests) GroupMethod() interface{} {
+	s.GroupCalls = append(s.GroupCalls, "GroupMethod")
+	// Group methods are called after Setup
+	return &InnerGroupTests{Outer: s, Name: "method", SetupCounter: s.Counter}
+}
+
+// methods with Group prefix not returning a group struct are not run
+func (s *OuterGroupTests) GroupName() string {
+	s.GroupCalls = append(s.GroupCalls, "GroupName")
+	return "outer"
+}
+
+func (s *OuterGroupTests) GroupNotStruct() interface{} {
+	s.GroupCalls = append(s.GroupCalls, "GroupNotStruct")
+	return "outer"
+}
+
+type InnerGroupTests struct {
+	Outer        *OuterGroupTests
+	Name         string
+	SetupCounter int
+}
+
+func (s *InnerGroupTests) Setup(t *testing.T) {
+	s.Outer.Log = append(s.Outer.Log, s.Name+" Setup")
+}
+
+func (s *InnerGroupTests) Teardown(t *testing.T) {
+	s.Outer.Log = append(s.Outer.Log, s.Name+" Teardown")
+}
+
+func (s *InnerGroupTests) BeforeEach(t *testing.T) {
+	s.Outer.Log = append(s.Outer.Log, s.Name+" BeforeEach")
+}
+
+func (s *InnerGroupTests) AfterEach(t *testing.T) {
+	s.Outer.Log = append(s.Outer.Log, s.Name+" AfterEach")
+}
+
+// group scoped fixtures constructed by outer group are reused
+func (s *InnerGroupTests) SubTestInner(t *testing.T, fixtures struct {
+	Counter int `fixture:"GroupCounter"`
+}) {
+	assert.Equal(t, s.Outer.Counter, fixtures.Counter)
+	if s.Name == "method" {
+		assert.Equal(t, fixtures.Counter, s.SetupCounter)
+	}
+	s.Outer.Log = append(s.Outer.Log, t.Name())
+}
+
+func TestNestedGroups(t *testing.T) {
+	testGroup := &OuterGroupTests{}
+	testGroup.GroupField = &InnerGroupTests{Outer: testGroup, Name: "field"}
+	gtest.RunSubTests(t, testGroup)
+
+	assert.Equal(t, []string{
+		"outer Setup",
+		"outer BeforeEach",
+		"Outer",
+		"outer AfterEach",
+		"method Setup",
+		"outer BeforeEach",
+		"method BeforeEach",
+		"TestNestedGroups/Method/Inner",
+		"method AfterEach",
+		"outer AfterEach",
+		"method Teardown",
+		"field Setup",
+		"outer BeforeEach",
+		"field BeforeEach",
+		"TestNestedGroups/Field/Inner",
+		"field AfterEach",
+		"outer AfterEach",
+		"field Teardown",
+		"outer Teardown",
+	}, testGroup.Log)
+	// Group methods are called once to discover nested groups, methods
+	// returning non-struct types are skipped
+	assert.Equal(t, []string{"GroupMethod", "GroupNotStruct"}, testGroup.GroupCalls)
+}
+
+type FieldInjectionTests struct {
+	Counter int    `fixture:"GroupCounter"`
+	Dir     string `fixture:"TmpDir"`
+	Label   string
+
+	SetupCounter  int
+	BeforeEachDir string
+	TeardownDir   string
+}
+
+func (s *FieldInjectionTests) Setup(t *testing.T) {
+	s.SetupCounter = s.Counter
+	// subtest scoped fields are not injected yet
+	assert.Empty(t, s.Dir)
+}
+
+func (s *FieldInjectionTests) Teardown(t *testing.T) {
+	s.TeardownDir = s.Dir
+}
+
+func (s *FieldInjectionTests) BeforeEach(t *testing.T) {
+	s.BeforeEachDir = s.Dir
+}
+
+func (s *FieldInjectionTests) SubTestFields(t *testing.T, fixtures struct {
+	Counter int    `fixture:"GroupCounter"`
+	Dir     string `fixture:"TmpDir"`
+}) {
+	assert.NotZero(t, s.Counter)
+	assert.Equal(t, fixtures.Counter, s.Counter)
+	assert.Equal(t, fixtures.Dir, s.Dir)
+	assert.Equal(t, s.Dir, s.BeforeEachDir)
+}
+
+func TestGroupFieldInjection(t *testing.T) {
+	testGroup := &FieldInjectionTests{}
+	gtest.RunSubTests(t, testGroup)
+
+	assert.NotZero(t, testGroup.SetupCounter)
+	// fields are cleared once their fixtures are destructed
+	assert.Empty(t, testGroup.TeardownDir)
+	assert.Zero(t, testGroup.Counter)
+	assert.Empty(t, testGroup.Dir)
+}
+
+type ParallelFieldTests struct {
+	Counter int    `fixture:"GroupCounter"`
+	Dir     string `fixture:"TmpDir"`
+}
+
+func (s *ParallelFieldTests) SubTestField(t *testing.T) {}
+
+// subtest scoped group fields would be shared by parallel subtests
+func TestParallelGroupFields(t *testing.T) {
+	assert.NoError(t, gtest.Validate(&ParallelFieldTests{}))
+	err := gtest.Validate(&ParallelFieldTests{}, gtest.WithParallel())
+	assert.EqualError(t, err, "Found 1 problem(s):\n\t"+
+		"*gtest_test.ParallelFieldTests's field Dir is injected for each subtest, "+
+		"which is not supported with WithParallel option")
+}
+
+type InvalidGroupTests struct{}
+
+func (s *InvalidGroupTests) BeforeEach(t *testing.T, fixtures struct {
+	Dir string `fixture:"Unknown"`
+}) {
+}
+
+func (s *InvalidGroupTests) SubTestNoT(fixtures struct{}) {}
+
+func (s *InvalidGroupTests) SubTestNoProvider(t *testing.T, fixtures struct {
+	Dir string
+}) {
+}
+
+func (s *InvalidGroupTests) SubTestWrongType(t *testing.T, fixtures struct {
+	Dir int `fixture:"Dir"`
+}) {
+}
+
+func (s *InvalidGroupTests) SubTestCycle(t *testing.T, fixtures struct {
+	A string `fixture:"CycleA"`
+}) {
+}
+
+func (s *InvalidGroupTests) CasesWrongCase() []int {
+	return []int{1}
+}
+
+func (s *InvalidGroupTests) SubTestWrongCase(t *testing.T, tc string) {}
+
+func TestValidate(t *testing.T) {
+	reg := gtest.NewRegistry()
+	reg.MustRegisterFunc("Dir", func(t *testing.T, fixtures struct{}) (string, func()) {
+		return "", nil
+	}, gtest.ScopeSubTest)
+	reg.MustRegisterFunc("CycleA", func(t *testing.T, fixtures struct {
+		B string `fixture:"CycleB"`
+	}) (string, func()) {
+		return "", nil
+	}, gtest.ScopeSubTest)
+	reg.MustRegisterFunc("CycleB", func(t *testing.T, fixtures struct {
+		A string `fixture:"CycleA"`
+	}) (string, func()) {
+		return "", nil
+	}, gtest.ScopeSubTest)
+
+	err := gtest.Validate(&InvalidGroupTests{}, gtest.WithRegistry(reg))
+	assert.Error(t, err)
+	verr, ok := err.(*gtest.ValidationError)
+	assert.True(t, ok)
+
+	problems := []string{}
+	for _, p := range verr.Problems {
+		problems = append(problems, p.Error())
+	}
+	assert.ElementsMatch(t, []string{
+		"Unregistered fixture found for caller *gtest_test.InvalidGroupTests.BeforeEach: Unknown",
+		"Fixture dependency cycle found for caller fixture 'CycleB': CycleA -> CycleB -> CycleA",
+		"No fixture provides type string for *gtest_test.InvalidGroupTests.SubTestNoProvider's fixture Dir",
+		"Method *gtest_test.InvalidGroupTests.SubTestNoT must have *testing.T as first parameter",
+		"*gtest_test.InvalidGroupTests.SubTestWrongType's fixture Dir has type int, fixture 'Dir' returns string",
+		"Method *gtest_test.InvalidGroupTests.SubTestWrongCase takes test case of type string, CasesWrongCase returns []int",
+	}, problems)
+
+	assert.NoError(t, gtest.Validate(&GTestTests{}))
+	assert.NoError(t, gtest.Validate(&OuterGroupTests{}))
+}
+
+// test group passed by value
+type ValueGroupTests struct{}
+
+func (s ValueGroupTests) SubTestValue(t *testing.T) {}
+
+func TestValueGroup(t *testing.T) {
+	gtest.RunSubTests(t, ValueGroupTests{})
+}
+
+func TestRegistryCheckCycles(t *testing.T) {
+	fn := func(t *testing.T, fixtures struct{}) (string, func()) { return "", nil }
+	reg := gtest.NewRegistry()
+	reg.MustRegisterFunc("Leaf", fn, gtest.ScopeSubTest)
+	reg.MustRegisterFunc("A", func(t *testing.T, fixtures struct {
+		B    string `fixture:"B"`
+		Leaf string `fixture:"Leaf"`
+	}) (string, func()) {
+		return "", nil
+	}, gtest.ScopeSubTest)
+	assert.NoError(t, reg.CheckCycles())
+
+	reg.MustRegisterFunc("B", func(t *testing.T, fixtures struct {
+		C string `fixture:"C"`
+	}) (string, func()) {
+		return "", nil
+	}, gtest.ScopeSubTest)
+	reg.MustRegisterFunc("C", func(t *testing.T, fixtures struct {
+		A string `fixture:"A"`
+	}) (string, func()) {
+		return "", nil
+	}, gtest.ScopeSubTest)
+	reg.MustRegisterFunc("Self", func(t *testing.T, fixtures struct {
+		Self string `fixture:"Self"`
+	}) (string, func()) {
+		return "", nil
+	}, gtest.ScopeSubTest)
+
+	err := reg.CheckCycles()
+	assert.EqualError(t, err, "Found 2 problem(s):\n"+
+		"\tFixture dependency cycle found: A -> B -> C -> A\n"+
+		"\tFixture dependency cycle found: Self -> Self")
+
+	assert.NoError(t, gtest.DefaultRegistry.CheckCycles())
+}
+
+// fixture configured through fixture tag arguments
+type RoleUserFixture struct {
+	ConstructCount int
+}
+
+func (s *RoleUserFixture) Construct(t *testing.T, req *gtest.Request, fixtures struct{}) (string, interface{}) {
+	s.ConstructCount += 1
+	return req.Args["role"] + "_user", nil
+}
+
+func (s *RoleUserFixture) Destruct(t *testing.T, ctx interface{}) {}
+
+type TagOptionTests struct {
+	RoleUser *RoleUserFixture
+}
+
+func (s *TagOptionTests) SubTestArgs(t *testing.T, fixtures struct {
+	Admin  string `fixture:"RoleUser,role=admin"`
+	Admin2 string `fixture:"RoleUser,role=admin"`
+	Guest  string `fixture:"RoleUser,role=guest"`
+}) {
+	assert.Equal(t, "admin_user", fixtures.Admin)
+	assert.Equal(t, "admin_user", fixtures.Admin2)
+	assert.Equal(t, "guest_user", fixtures.Guest)
+	// fixture is cached per set of arguments
+	assert.Equal(t, 2, s.RoleUser.ConstructCount)
+}
+
+func (s *TagOptionTests) SubTestOptional(t *testing.T, fixtures struct {
+	Db      *os.File      `fixture:"MissingDb,optional"`
+	Port    int           `fixture:"MissingPort,default=8080"`
+	Timeout time.Duration `fixture:"MissingTimeout,default=5s"`
+	Dir     string        `fixture:"TmpDir,optional"`
+}) {
+	assert.Nil(t, fixtures.Db)
+	assert.Equal(t, 8080, fixtures.Port)
+	assert.Equal(t, 5*time.Second, fixtures.Timeout)
+	// registered optional fixture is resolved as usual
+	assert.NotEmpty(t, fixtures.Dir)
+}
+
+func TestFixtureTagOptions(t *testing.T) {
+	roleUser := &RoleUserFixture{}
+	reg := gtest.DefaultRegistry.Clone()
+	reg.MustRegister("RoleUser", roleUser, gtest.ScopeSubTest)
+	gtest.RunSubTests(t, &TagOptionTests{RoleUser: roleUser}, gtest.WithRegistry(reg))
+
+	err := gtest.Validate(&struct {
+		Port int `fixture:"MissingPort,default=http"`
+		Dir  int `fixture:"TmpDir,flag"`
+	}{})
+	assert.EqualError(t, err, "Found 2 problem(s):\n"+
+		"\t*struct { Port int \"fixture:\\\"MissingPort,default=http\\\"\"; Dir int \"fixture:\\\"TmpDir,flag\\\"\" }'s "+
+		"fixture Port has invalid default value: cannot parse \"http\" as int: expected integer\n"+
+		"\t*struct { Port int \"fixture:\\\"MissingPort,default=http\\\"\"; Dir int \"fixture:\\\"TmpDir,flag\\\"\" }: "+
+		"Invalid option for fixture 'TmpDir': flag")
+}
+
+type TypedServer struct {
+	Name string
+}
+
+type TypeInjectionTests struct {
+	Server *TypedServer `fixture:""`
+}
+
+func (s *TypeInjectionTests) SubTestByType(t *testing.T, fixtures struct {
+	Server *TypedServer
+	Plain  *TypedServer `fixture:"PlainServer"`
+	Port   int          `fixture:",default=8080"`
+}) {
+	assert.Equal(t, "primary", fixtures.Server.Name)
+	assert.Same(t, s.Server, fixtures.Server)
+	assert.Equal(t, "plain", fixtures.Plain.Name)
+	assert.Equal(t, 8080, fixtures.Port)
+}
+
+func TestTypeInjection(t *testing.T) {
+	reg := gtest.NewRegistry()
+	reg.MustRegisterFunc("PrimaryServer", func(t *testing.T, fixtures struct{}) (*TypedServer, func()) {
+		return &TypedServer{Name: "primary"}, nil
+	}, gtest.ScopeGroup, gtest.WithTypeProvider())
+	reg.MustRegisterFunc("PlainServer", func(t *testing.T, fixtures struct{}) (*TypedServer, func()) {
+		return &TypedServer{Name: "plain"}, nil
+	}, gtest.ScopeSubTest)
+	gtest.RunSubTests(t, &TypeInjectionTests{}, gtest.WithRegistry(reg))
+
+	reg.MustRegisterFunc("SecondaryServer", func(t *testing.T, fixtures struct{}) (*TypedServer, func()) {
+		return &TypedServer{Name: "secondary"}, nil
+	}, gtest.ScopeGroup, gtest.WithTypeProvider())
+	err := gtest.Validate(&TypeInjectionTests{}, gtest.WithRegistry(reg))
+	assert.EqualError(t, err, "Found 2 problem(s):\n"+
+		"\tAmbiguous fixture providers for *gtest_test.TypeInjectionTests's fixture Server "+
+		"of type *gtest_test.TypedServer: PrimaryServer, SecondaryServer\n"+
+		"\tAmbiguous fixture providers for *gtest_test.TypeInjectionTests.SubTestByType's fixture Server "+
+		"of type *gtest_test.TypedServer: PrimaryServer, SecondaryServer")
+}
+
+// fixture inspecting request it is constructed for
+type RequestInfoFixture struct {
+	LastRequest *gtest.Request
+	Events      []string
+}
+
+func (s *RequestInfoFixture) Construct(t *testing.T, req *gtest.Request, fixtures struct{}) (string, interface{}) {
+	s.LastRequest = req
+	req.AddFinalizer(func() { s.Events = append(s.Events, "finalize") })
+	return req.Group.Elem().Name() + "." + req.SubTest + "." + req.Field, nil
+}
+
+func (s *RequestInfoFixture) Destruct(t *testing.T, ctx interface{}) {
+	s.Events = append(s.Events, "destruct")
+}
+
+type RequestTests struct {
+	Info *RequestInfoFixture
+}
+
+func (s *RequestTests) SubTestInfo(t *testing.T, fixtures struct {
+	Name string `fixture:"RequestInfo,optional,kind=temp"`
+}) {
+	assert.Equal(t, "RequestTests.SubTestInfo.Name", fixtures.Name)
+	req := s.Info.LastRequest
+	assert.Equal(t, []string{"optional", "kind=temp"}, req.Options)
+	assert.Equal(t, map[string]string{"kind": "temp"}, req.Args)
+	assert.Equal(t, gtest.ScopeSubTest, req.Scope)
+	assert.Nil(t, req.Param)
+	assert.Empty(t, s.Info.Events)
+}
+
+func TestFixtureRequest(t *testing.T) {
+	info := &RequestInfoFixture{}
+	reg := gtest.NewRegistry()
+	reg.MustRegister("RequestInfo", info, gtest.ScopeSubTest)
+	gtest.RunSubTests(t, &RequestTests{Info: info}, gtest.WithRegistry(reg))
+	// finalizers are called after Destruct
+	assert.Equal(t, []string{"destruct", "finalize"}, info.Events)
+}
+
+// fixture counting its constructions and destructions
+type UseCounterFixture struct {
+	Constructed int
+	Destructed  int
+}
+
+func (s *UseCounterFixture) Construct(t *testing.T, fixtures struct{}) (int, interface{}) {
+	s.Constructed += 1
+	return s.Constructed, nil
+}
+
+func (s *UseCounterFixture) Destruct(t *testing.T, ctx interface{}) {
+	s.Destructed += 1
+}
+
+type UseTests struct {
+	Counter *UseCounterFixture
+}
+
+func (s *UseTests) SubTestUse(t *testing.T, fixtures struct {
+	Count int `fixture:"UseCounter"`
+}) {
+	// value is shared with fixtures struct
+	assert.Equal(t, fixtures.Count, gtest.Use(t, "UseCounter"))
+	assert.Equal(t, 1, s.Counter.Constructed)
+	if fixtures.Count > 0 {
+		assert.Equal(t, "dir", gtest.Use(t, "UseDir"))
+	}
+}
+
+func (s *UseTests) SubTestUseOnly(t *testing.T) {
+	before := s.Counter.Destructed
+	assert.Equal(t, gtest.Use(t, "UseCounter"), gtest.Use(t, "UseCounter"))
+	assert.Equal(t, before, s.Counter.Destructed)
+}
+
+func TestUse(t *testing.T) {
+	counter := &UseCounterFixture{}
+	reg := gtest.NewRegistry()
+	reg.MustRegister("UseCounter", counter, gtest.ScopeSubTest)
+	reg.MustRegisterFunc("UseDir", func(t *testing.T, fixtures struct{}) (string, func()) {
+		return "dir", nil
+	}, gtest.ScopeSubTest)
+	gtest.RunSubTests(t, &UseTests{Counter: counter}, gtest.WithRegistry(reg))
+	assert.Equal(t, 2, counter.Constructed)
+	assert.Equal(t, 2, counter.Destructed)
+}
@@ -0,0 +1,391 @@
+package gtest
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type FixtureEntry struct {
+	Scope    FixtureScope
+	Instance interface{}
+	// ConstructTimeout limits how long Construct can take, zero means no
+	// limit.
+	ConstructTimeout time.Duration
+	// Params makes the fixture parametrized, each SubTest using the fixture
+	// runs once per parameter.
+	Params []interface{}
+	// Autouse fixtures are constructed for every SubTest run against the
+	// registry, even if the SubTest doesn't reference them.
+	Autouse bool
+	// TypeProvider fixtures are injected into fields tagged without fixture
+	// name, or not tagged at all, based on type of their value.
+	TypeProvider bool
+
+	// registry the fixture is registered in, fixture's dependencies are
+	// resolved from the same registry.
+	registry *Registry
+	// key identifies fixture instance in resolver cache
+	key interface{}
+	// instanceMu serializes Construct and Destruct calls on the fixture
+	// instance, so fixtures don't need to guard their own state when used
+	// from parallel subtests.
+	instanceMu *sync.Mutex
+	// constructVal and destructVal are the fixture's Construct and Destruct
+	// methods. destructVal is not set for function fixtures, which return a
+	// cleanup function instead of destruct context.
+	constructVal reflect.Value
+	destructVal  reflect.Value
+}
+
+// fixturesType returns type of fixtures struct taken by fixture's Construct.
+func (e FixtureEntry) fixturesType() reflect.Type {
+	fnType := e.constructVal.Type()
+	return fnType.In(fnType.NumIn() - 1)
+}
+
+// valueType returns type of fixture value returned by fixture's Construct.
+func (e FixtureEntry) valueType() reflect.Type {
+	return e.constructVal.Type().Out(0)
+}
+
+// funcFixture identifies fixture registered with RegisterFixtureFunc in
+// resolver cache, since function values can't be used as map keys.
+type funcFixture struct {
+	fn reflect.Value
+}
+
+// uncomparableFixture identifies fixture instance of a type that can't be
+// used as map key, e.g. a struct value with slice field, in resolver cache.
+type uncomparableFixture struct {
+	instance interface{}
+}
+
+// FixtureOption configures optional behavior of a registered fixture.
+type FixtureOption func(entry *FixtureEntry)
+
+// WithConstructTimeout fails fixture construction if Construct takes longer
+// than d. Context passed to Construct will be cancelled after d as well.
+//
+// Construct runs in its own goroutine, so the timeout is reported even if
+// Construct keeps blocking. It should therefore not call t.FailNow, which only
+// stops the Construct goroutine. Value returned after the timeout is still
+// destructed, if Construct returns before the fixture's scope ends.
+func WithConstructTimeout(d time.Duration) FixtureOption {
+	return func(entry *FixtureEntry) {
+		entry.ConstructTimeout = d
+	}
+}
+
+// WithParams parametrizes fixture with given parameters. Each SubTest
+// depending on the fixture, directly or through other fixtures, runs once per
+// parameter. Parameter selected for the current run is returned by Param.
+func WithParams(params ...interface{}) FixtureOption {
+	return func(entry *FixtureEntry) {
+		entry.Params = params
+	}
+}
+
+// WithAutouse constructs fixture for every SubTest run against the registry
+// the fixture is registered in.
+func WithAutouse() FixtureOption {
+	return func(entry *FixtureEntry) {
+		entry.Autouse = true
+	}
+}
+
+// WithTypeProvider registers fixture as provider for type of its value.
+// Fields of that type tagged without fixture name, e.g. `fixture:""`, or not
+// tagged at all in fixtures structs, are injected with the fixture.
+func WithTypeProvider() FixtureOption {
+	return func(entry *FixtureEntry) {
+		entry.TypeProvider = true
+	}
+}
+
+// Registry holds a set of named fixtures. It is safe for concurrent use.
+//
+// Package level fixture functions like RegisterFixture operate on
+// DefaultRegistry. Use WithRegistry option to run a test group against a
+// different registry.
+type Registry struct {
+	mu       sync.RWMutex
+	fixtures map[string]FixtureEntry
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		fixtures: map[string]FixtureEntry{},
+	}
+}
+
+// DefaultRegistry is used by package level fixture functions and test groups
+// that don't specify a registry.
+var DefaultRegistry = NewRegistry()
+
+// Register a fixture under a given name. A fixture needs to be registered
+// before it can be used in tests or other fixtures.
+//
+// Registration fails if the fixture depends on an already registered fixture
+// with narrower scope, or if an already registered fixture with wider scope
+// depends on it.
+//
+// Fixtures implementing Params() []interface{} are parametrized with
+// returned parameters, see WithParams.
+func (r *Registry) Register(name string, f interface{}, scope FixtureScope, opts ...FixtureOption) error {
+	fType := reflect.TypeOf(f)
+
+	err := validateFixtureConstructMethod(fType)
+	if err != nil {
+		return err
+	}
+
+	err = validateFixtureDestructMethod(fType)
+	if err != nil {
+		return err
+	}
+
+	fVal := reflect.ValueOf(f)
+	entry := FixtureEntry{
+		Scope:        scope,
+		Instance:     f,
+		key:          f,
+		constructVal: fVal.MethodByName("Construct"),
+		destructVal:  fVal.MethodByName("Destruct"),
+	}
+	if !fType.Comparable() {
+		entry.key = &uncomparableFixture{instance: f}
+	}
+	if p, ok := f.(interface{ Params() []interface{} }); ok {
+		entry.Params = p.Params()
+	}
+	return r.add(name, entry, opts)
+}
+
+// RegisterFunc registers a function as fixture under a given name. The
+// function takes the same parameters as fixture's Construct method, and
+// returns fixture value with a cleanup function instead of destruct context:
+//
+//    func(t *testing.T, fixtures struct{...}) (V, func())
+//
+// Optional context.Context first parameter and error third return value are
+// supported as well. Returned cleanup function can be nil.
+func (r *Registry) RegisterFunc(name string, fn interface{}, scope FixtureScope, opts ...FixtureOption) error {
+	err := validateFixtureFunc(reflect.TypeOf(fn))
+	if err != nil {
+		return err
+	}
+
+	fnVal := reflect.ValueOf(fn)
+	return r.add(name, FixtureEntry{
+		Scope:        scope,
+		Instance:     fn,
+		key:          &funcFixture{fn: fnVal},
+		constructVal: fnVal,
+	}, opts)
+}
+
+// Register a function fixture, panic if registration failed.
+func (r *Registry) MustRegisterFunc(name string, fn interface{}, scope FixtureScope, opts ...FixtureOption) {
+	err := r.RegisterFunc(name, fn, scope, opts...)
+	if err != nil {
+		panic(fmt.Sprintf("Failed to register fixture: %v", err))
+	}
+}
+
+// add registers validated fixture entry after checking scope of its
+// dependencies.
+func (r *Registry) add(name string, entry FixtureEntry, opts []FixtureOption) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	scope := entry.Scope
+	if existing, ok := r.fixtures[name]; ok {
+		return fmt.Errorf(
+			"Fixture '%s' has already been registered under scope: %s",
+			name, existing.Scope)
+	}
+
+	if scope.rank() < 0 {
+		return fmt.Errorf("Invalid scope for fixture '%s': %s", name, scope)
+	}
+
+	for _, dep := range fixtureDependencies(r.fixtures, entry.fixturesType()) {
+		depEntry, ok := r.fixtures[dep]
+		if !ok {
+			continue
+		}
+		err := checkScopeDependency(
+			fmt.Sprintf("fixture '%s'", name), scope, dep, depEntry.Scope)
+		if err != nil {
+			return err
+		}
+	}
+	for other, otherEntry := range r.fixtures {
+		for _, dep := range fixtureDependencies(r.fixtures, otherEntry.fixturesType()) {
+			if dep != name {
+				continue
+			}
+			err := checkScopeDependency(
+				fmt.Sprintf("fixture '%s'", other), otherEntry.Scope, name, scope)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	entry.registry = r
+	entry.instanceMu = &sync.Mutex{}
+	for _, opt := range opts {
+		opt(&entry)
+	}
+	r.fixtures[name] = entry
+	return nil
+}
+
+// Register a fixture, panic if registration failed.
+func (r *Registry) MustRegister(name string, f interface{}, scope FixtureScope, opts ...FixtureOption) {
+	err := r.Register(name, f, scope, opts...)
+	if err != nil {
+		panic(fmt.Sprintf("Failed to register fixture: %v", err))
+	}
+}
+
+func (r *Registry) Get(name string) (FixtureEntry, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	val, ok := r.fixtures[name]
+	return val, ok
+}
+
+// autouse returns names of autouse fixtures in r, sorted by name.
+func (r *Registry) autouse() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := []string{}
+	for name, entry := range r.fixtures {
+		if entry.Autouse {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// providers returns names of fixtures registered in r as provider for typ,
+// sorted by name.
+func (r *Registry) providers(typ reflect.Type) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return typeProviders(r.fixtures, typ)
+}
+
+func typeProviders(fixtures map[string]FixtureEntry, typ reflect.Type) []string {
+	names := []string{}
+	for name, entry := range fixtures {
+		if entry.TypeProvider && entry.valueType() == typ {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// dependencies returns names of fixtures in r referenced by fixtures struct.
+func (r *Registry) dependencies(fixturesType reflect.Type) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return fixtureDependencies(r.fixtures, fixturesType)
+}
+
+// Unregister removes fixture registered under given name, returns false if
+// no such fixture exists.
+func (r *Registry) Unregister(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.fixtures[name]
+	delete(r.fixtures, name)
+	return ok
+}
+
+// Clone returns a new registry with all fixtures registered in r. Changes to
+// the new registry won't affect r.
+func (r *Registry) Clone() *Registry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	clone := NewRegistry()
+	for name, entry := range r.fixtures {
+		entry.registry = clone
+		clone.fixtures[name] = entry
+	}
+	return clone
+}
+
+// CheckCycles checks dependencies of all fixtures in r, and reports every
+// dependency cycle found with a *ValidationError, e.g. "A -> B -> A".
+func (r *Registry) CheckCycles() error {
+	r.mu.RLock()
+	names := make([]string, 0, len(r.fixtures))
+	deps := map[string][]string{}
+	for name, entry := range r.fixtures {
+		names = append(names, name)
+		deps[name] = fixtureDependencies(r.fixtures, entry.fixturesType())
+	}
+	r.mu.RUnlock()
+	sort.Strings(names)
+
+	problems := []error{}
+	done := map[string]bool{}
+	var visit func(name string, path []string)
+	visit = func(name string, path []string) {
+		if cycle := dependencyCycle(path, name); cycle != nil {
+			problems = append(problems, fmt.Errorf(
+				"Fixture dependency cycle found: %s", strings.Join(cycle, " -> ")))
+			return
+		}
+		if done[name] {
+			return
+		}
+		path = append(path, name)
+		for _, dep := range deps[name] {
+			visit(dep, path)
+		}
+		done[name] = true
+	}
+	for _, name := range names {
+		visit(name, nil)
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// Register a fixture in DefaultRegistry.
+func RegisterFixture(name string, f interface{}, scope FixtureScope, opts ...FixtureOption) error {
+	return DefaultRegistry.Register(name, f, scope, opts...)
+}
+
+// Register a fixture in DefaultRegistry, panic if registration failed.
+func MustRegisterFixture(name string, f interface{}, scope FixtureScope, opts ...FixtureOption) {
+	DefaultRegistry.MustRegister(name, f, scope, opts...)
+}
+
+// Register a function fixture in DefaultRegistry.
+func RegisterFixtureFunc(name string, fn interface{}, scope FixtureScope, opts ...FixtureOption) error {
+	return DefaultRegistry.RegisterFunc(name, fn, scope, opts...)
+}
+
+// Register a function fixture in DefaultRegistry, panic if registration
+// failed.
+func MustRegisterFixtureFunc(name string, fn interface{}, scope FixtureScope, opts ...FixtureOption) {
+	DefaultRegistry.MustRegisterFunc(name, fn, scope, opts...)
+}
+
+func GetFixture(name string) (FixtureEntry, bool) {
+	return DefaultRegistry.Get(name)
+}
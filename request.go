@@ -0,0 +1,154 @@
+package gtest
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/structtag"
+)
+
+// Request describes a request for a fixture value. Fixture Construct methods
+// and functions can take *Request between *testing.T and fixtures struct:
+//
+//    func (s *UserFixture) Construct(t *testing.T, req *gtest.Request, fixtures struct{}) (*User, interface{})
+//
+// Cached fixtures are constructed once, so Request describes the first
+// request that led to the fixture being constructed.
+type Request struct {
+	// Group is type of the test group requesting the fixture.
+	Group reflect.Type
+	// SubTest is name of the SubTest method requesting the fixture, directly
+	// or through other fixtures. It's empty for fixtures requested by group
+	// hooks and group fields injected before Setup.
+	SubTest string
+	// Field is name of the struct field the fixture is injected into, empty
+	// for fixtures requested imperatively, e.g. through Handle.Get.
+	Field string
+	// Options holds options from fixture tag of the requesting field, e.g.
+	// [optional role=admin] for `fixture:"User,optional,role=admin"`.
+	Options []string
+	// Args holds keyed arguments from fixture tag of the requesting field,
+	// e.g. `fixture:"User,role=admin"`. Fixtures are cached separately for
+	// each set of arguments.
+	Args map[string]string
+	// Scope the fixture is registered with.
+	Scope FixtureScope
+	// Param is parameter selected for parametrized fixture, nil otherwise.
+	Param interface{}
+
+	mu         sync.Mutex
+	finalizers []func()
+}
+
+// AddFinalizer schedules fn to be called after the fixture is destructed.
+// Finalizers are called in reverse order they were added, even if Construct
+// fails.
+func (r *Request) AddFinalizer(fn func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.finalizers = append(r.finalizers, fn)
+}
+
+// finalize calls finalizers added to request.
+func (r *Request) finalize() {
+	r.mu.Lock()
+	finalizers := r.finalizers
+	r.finalizers = nil
+	r.mu.Unlock()
+	for i := len(finalizers) - 1; i >= 0; i-- {
+		finalizers[i]()
+	}
+}
+
+var requestType = reflect.TypeOf(&Request{})
+
+// takesRequest returns true if construct function takes *Request before
+// fixtures struct. Function type is expected to not include receiver.
+func takesRequest(fnType reflect.Type) bool {
+	n := fnType.NumIn()
+	return n >= 3 && fnType.In(n-2) == requestType
+}
+
+// fixtureTag is a parsed fixture struct tag, e.g.
+// `fixture:"Port,optional,default=8080,key=value"`.
+type fixtureTag struct {
+	Name    string
+	Options []string
+	// Optional fields are left with zero value if fixture is not registered.
+	Optional bool
+	// Default is assigned to the field if fixture is not registered.
+	Default    string
+	HasDefault bool
+	// Args are passed to Construct through Request.
+	Args map[string]string
+}
+
+// parseFixtureTag parses fixture tag of struct field, returns false if the
+// field doesn't have fixture tag.
+func parseFixtureTag(field reflect.StructField) (fixtureTag, bool, error) {
+	tags, err := structtag.Parse(string(field.Tag))
+	if err != nil {
+		return fixtureTag{}, false, fmt.Errorf("Invalid tag encountered for fixture: %s", field.Tag)
+	}
+	tag, err := tags.Get("fixture")
+	if err != nil {
+		return fixtureTag{}, false, nil
+	}
+
+	ftag := fixtureTag{Name: tag.Name, Options: tag.Options}
+	for _, opt := range tag.Options {
+		kv := strings.SplitN(opt, "=", 2)
+		switch {
+		case opt == "optional":
+			ftag.Optional = true
+		case len(kv) != 2 || kv[0] == "":
+			return ftag, true, fmt.Errorf(
+				"Invalid option for fixture '%s': %s", tag.Name, opt)
+		case kv[0] == "default":
+			ftag.Default = kv[1]
+			ftag.HasDefault = true
+		default:
+			if ftag.Args == nil {
+				ftag.Args = map[string]string{}
+			}
+			ftag.Args[kv[0]] = kv[1]
+		}
+	}
+	return ftag, true, nil
+}
+
+// argsKey encodes fixture arguments for resolver cache key.
+func argsKey(args map[string]string) string {
+	parts := make([]string, 0, len(args))
+	for k, v := range args {
+		parts = append(parts, k+"="+v)
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// parseDefault converts default value from fixture tag to value of type typ.
+func parseDefault(s string, typ reflect.Type) (reflect.Value, error) {
+	valPtr := reflect.New(typ)
+	switch {
+	case typ == durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		valPtr.Elem().SetInt(int64(d))
+	case typ.Kind() == reflect.String:
+		valPtr.Elem().SetString(s)
+	default:
+		if _, err := fmt.Sscan(s, valPtr.Interface()); err != nil {
+			return reflect.Value{}, fmt.Errorf("cannot parse %q as %s: %v", s, typ, err)
+		}
+	}
+	return valPtr.Elem(), nil
+}
@@ -0,0 +1,131 @@
+package gtest
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// sessionResolver caches ScopeSession fixtures for the whole test binary, they
+// are destructed by Main.
+var sessionResolver = newFixtureResolver(nil, ScopeSession, nil)
+
+var (
+	// mainCalled is set once Main is called, session fixtures are never
+	// destructed without it.
+	mainCalled int32
+	// warnWithoutMainOnce makes sure missing Main is only reported once per
+	// test binary.
+	warnWithoutMainOnce sync.Once
+)
+
+// Main runs all tests in a test binary and then destructs ScopeSession
+// fixtures. It is meant to be called from TestMain:
+//
+//    func TestMain(m *testing.M) {
+//      gtest.Main(m)
+//    }
+//
+// Session fixture Destruct failures are reported to stderr, Main exits with
+// non-zero code if any test or session fixture Destruct failed. Test binaries
+// constructing session fixtures without calling Main report it to stderr.
+func Main(m *testing.M) {
+	atomic.StoreInt32(&mainCalled, 1)
+	code := m.Run()
+	if !destructSessionFixtures(sessionResolver, os.Stderr) && code == 0 {
+		code = 1
+	}
+	os.Exit(code)
+}
+
+// warnWithoutMain reports to w that session fixture name won't be destructed
+// if Main has not been called.
+func warnWithoutMain(w io.Writer, name string) {
+	if atomic.LoadInt32(&mainCalled) == 1 {
+		return
+	}
+	warnWithoutMainOnce.Do(func() {
+		fmt.Fprintf(w,
+			"gtest: session fixture '%s' is constructed without calling gtest.Main from TestMain, "+
+				"session fixtures won't be destructed\n", name)
+	})
+}
+
+// destructSessionFixtures destructs fixtures cached by resolver once all
+// tests have finished, and reports failures to w.
+func destructSessionFixtures(resolver *fixtureResolver, w io.Writer) bool {
+	ok, out, err := runOutsideTests(resolver.cleanUp)
+	if err != nil {
+		fmt.Fprintf(w, "gtest: failed to destruct session fixtures: %v\n", err)
+		return false
+	}
+	if !ok {
+		fmt.Fprintln(w, "gtest: failed to destruct session fixtures:")
+		for _, line := range out {
+			fmt.Fprintln(w, line)
+		}
+	}
+	return ok
+}
+
+// runOutsideTests calls f with a *testing.T once all tests of the test binary
+// have finished, and returns whether f passed along with lines it logged.
+//
+// Destruct methods take *testing.T, which can only be created by the testing
+// package, so f is run as a private test through testing.RunTests. RunTests is
+// documented as an internal function of the testing package, this adapter is
+// the only place depending on it and on the format of its output:
+//
+//   - command line filters of the test binary are reset, so they don't skip
+//     the private test;
+//   - os.Stdout is redirected to a pipe while the private test runs, so it is
+//     not reported as a test of the test binary, e.g. by go test -json;
+//   - test framing lines, e.g. "=== RUN" and "--- FAIL", are dropped from the
+//     captured output, leaving only lines logged by f.
+//
+// If a future Go release changes any of these, only this function needs to be
+// updated.
+func runOutsideTests(f func(t *testing.T)) (ok bool, lines []string, err error) {
+	for _, name := range []string{"test.run", "test.skip", "test.failfast"} {
+		if fl := flag.Lookup(name); fl != nil {
+			_ = fl.Value.Set(fl.DefValue)
+		}
+	}
+
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		return false, nil, err
+	}
+	output := make(chan []byte)
+	go func() {
+		out, _ := ioutil.ReadAll(pr)
+		output <- out
+	}()
+
+	stdout := os.Stdout
+	os.Stdout = pw
+	ok = testing.RunTests(
+		func(pat, str string) (bool, error) { return true, nil },
+		[]testing.InternalTest{{Name: "GTestSessionTeardown", F: f}},
+	)
+	os.Stdout = stdout
+	pw.Close()
+	out := <-output
+	pr.Close()
+
+	for _, line := range strings.Split(strings.TrimRight(string(out), "\n"), "\n") {
+		// test2json framing lines may be prefixed with ^V
+		trimmed := strings.TrimLeft(line, "\x16 ")
+		if strings.HasPrefix(trimmed, "=== ") || strings.HasPrefix(trimmed, "--- ") || trimmed == "" {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return ok, lines, nil
+}
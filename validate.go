@@ -0,0 +1,287 @@
+package gtest
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// ValidationError lists all problems found by Validate or
+// Registry.CheckCycles.
+type ValidationError struct {
+	Problems []error
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		msgs[i] = p.Error()
+	}
+	return fmt.Sprintf(
+		"Found %d problem(s):\n\t%s", len(msgs), strings.Join(msgs, "\n\t"))
+}
+
+// Validate checks a test group without running it. It checks signatures of
+// SubTest, Cases and hook methods, fixture tags of fixtures structs and group
+// fields, and that all referenced fixtures and their dependencies are
+// registered, have compatible scopes and don't form dependency cycles.
+// Nested groups returned by Group methods of gt as is, without calling Setup,
+// are checked as well.
+//
+// All problems are reported at once with a *ValidationError. RunSubTests
+// calls Validate for each test group before calling its Setup and fails the
+// test if any problem is found.
+func Validate(gt interface{}, opts ...RunOption) error {
+	cfg := runConfig{registry: DefaultRegistry}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return validate(gt, cfg, cfg.registry.autouse(), true)
+}
+
+// validate checks test group gt, autoFixtures are autouse fixtures inherited
+// from registry and enclosing groups. Nested groups are only checked if
+// nested is set.
+func validate(gt interface{}, cfg runConfig, autoFixtures []string, nested bool) error {
+	v := &validator{checked: map[string]bool{}, parallel: cfg.parallel, nested: nested}
+	v.group(reflect.ValueOf(gt), cfg.registry, autoFixtures)
+	if len(v.problems) > 0 {
+		return &ValidationError{Problems: v.problems}
+	}
+	return nil
+}
+
+// validator collects problems found in a test group.
+type validator struct {
+	problems []error
+	// checked records fixtures whose dependencies have been checked for
+	// given effective scope
+	checked map[string]bool
+	// parallel is set if subtests run in parallel
+	parallel bool
+	// nested is set if nested groups are checked as well
+	nested bool
+}
+
+func (v *validator) addf(format string, args ...interface{}) {
+	v.problems = append(v.problems, fmt.Errorf(format, args...))
+}
+
+// group checks test group and its nested groups.
+func (v *validator) group(xv reflect.Value, reg *Registry, autoFixtures []string) {
+	groupName := xv.Type().String()
+
+	hooks, err := lookupGroupHooks(xv)
+	if err != nil {
+		v.addf("%s: %v", groupName, err)
+	}
+	for _, hook := range []struct {
+		name  string
+		val   reflect.Value
+		scope FixtureScope
+	}{
+		{"Setup", hooks.setup, ScopeGroup},
+		{"Teardown", hooks.teardown, ScopeGroup},
+		{"BeforeEach", hooks.beforeEach, ScopeSubTest},
+		{"AfterEach", hooks.afterEach, ScopeSubTest},
+	} {
+		if hook.val.IsValid() && hook.val.Type().NumIn() == 2 {
+			v.fixturesStruct(reg, groupName+"."+hook.name, hook.scope, hook.val.Type().In(1))
+		}
+	}
+
+	groupFields, subTestFields := groupFixtureFields(xv, reg)
+	for _, gf := range groupFields {
+		v.groupField(reg, groupName, ScopeGroup, gf)
+	}
+	for _, gf := range subTestFields {
+		// the group struct is shared by all subtests, so parallel subtests
+		// can't each have their own value in it
+		if v.parallel {
+			v.addf(
+				"%s's field %s is injected for each subtest, which is not supported with WithParallel option",
+				groupName, gf.field.Name)
+			continue
+		}
+		v.groupField(reg, groupName, ScopeSubTest, gf)
+	}
+
+	if af, ok := xv.Interface().(interface{ AutoFixtures() []string }); ok {
+		autoFixtures = append(append([]string{}, autoFixtures...), af.AutoFixtures()...)
+	}
+	for _, name := range autoFixtures {
+		v.fixture(reg, groupName+" autouse fixtures", ScopeSubTest, name, nil)
+	}
+
+	for _, method := range subTestMethods(xv.Type()) {
+		v.subTest(xv, reg, method)
+	}
+
+	if !v.nested {
+		return
+	}
+	for _, group := range nestedGroups(xv) {
+		v.group(reflect.ValueOf(group.group), reg, autoFixtures)
+	}
+}
+
+// subTest checks signature of SubTest method and its Cases method.
+func (v *validator) subTest(xv reflect.Value, reg *Registry, method reflect.Method) {
+	caller := fmt.Sprintf("%s.%s", xv.Type(), method.Name)
+	casesName := casesMethodPrefix + strings.TrimPrefix(method.Name, testMethodPrefix)
+	casesMethod, hasCases := xv.Type().MethodByName(casesName)
+	maxParamCount := 2
+	if hasCases {
+		maxParamCount = 3
+	}
+
+	// method.Type.NumIn() includes receiver
+	methodParamCount := method.Type.NumIn() - 1
+	if methodParamCount < 1 || method.Type.In(1) != reflect.TypeOf(&testing.T{}) {
+		v.addf("Method %s must have *testing.T as first parameter", caller)
+	}
+	if methodParamCount > maxParamCount {
+		v.addf("Method %s cannot take more than %d parameters, got %d", caller, maxParamCount, methodParamCount)
+		return
+	}
+
+	if hasCases {
+		casesType := casesMethod.Type
+		if casesType.NumIn() != 1 || casesType.NumOut() != 1 || casesType.Out(0).Kind() != reflect.Slice {
+			v.addf(
+				"Method %s.%s needs to take no parameters and return a slice, got: %s",
+				xv.Type(), casesName, casesType)
+		} else if methodParamCount < 2 {
+			v.addf("Method %s must take test case from %s as last parameter", caller, casesName)
+		} else if caseType := method.Type.In(methodParamCount); !casesType.Out(0).Elem().AssignableTo(caseType) {
+			v.addf(
+				"Method %s takes test case of type %s, %s returns %s",
+				caller, caseType, casesName, casesType.Out(0))
+		}
+	}
+
+	if methodParamCount == maxParamCount {
+		v.fixturesStruct(reg, caller, ScopeSubTest, method.Type.In(2))
+	}
+}
+
+// fixturesStruct checks fixtures struct taken by caller.
+func (v *validator) fixturesStruct(reg *Registry, caller string, scope FixtureScope, fixturesType reflect.Type) {
+	if fixturesType.Kind() != reflect.Struct {
+		v.addf("%s needs to take fixtures struct, got: %s", caller, fixturesType)
+		return
+	}
+	v.fields(reg, caller, scope, fixturesType, nil)
+}
+
+// fields checks fields of fixtures struct taken by caller. path holds
+// fixtures leading to caller if caller is a fixture.
+func (v *validator) fields(
+	reg *Registry, caller string, scope FixtureScope, fixturesType reflect.Type, path []string,
+) {
+	for j := 0; j < fixturesType.NumField(); j++ {
+		field := fixturesType.Field(j)
+		// fields without fixture tag are injected based on their type
+		ftag, _, err := parseFixtureTag(field)
+		if err != nil {
+			v.addf("%s: %v", caller, err)
+			continue
+		}
+		v.field(reg, caller, scope, ftag, field, path)
+	}
+}
+
+// groupField checks test group field tagged with fixture tag.
+func (v *validator) groupField(reg *Registry, caller string, scope FixtureScope, gf groupField) {
+	if gf.err != nil {
+		v.addf("%s: %v", caller, gf.err)
+		return
+	}
+	v.field(reg, caller, scope, gf.tag, gf.field, nil)
+}
+
+// field checks struct field injected with fixture referenced by fixture tag.
+func (v *validator) field(
+	reg *Registry, caller string, scope FixtureScope, ftag fixtureTag, field reflect.StructField, path []string,
+) {
+	if field.PkgPath != "" {
+		v.addf("%s's fixture %s needs to be an exported struct field", caller, field.Name)
+	}
+	if isLazyField(field) {
+		if err := checkLazyField(caller, scope, len(path) > 0, field); err != nil {
+			v.problems = append(v.problems, err)
+			return
+		}
+	}
+	field.Type = fieldValueType(field.Type)
+	name, err := fieldFixture(reg, caller, ftag, field)
+	if err != nil {
+		v.problems = append(v.problems, err)
+		return
+	}
+	if _, ok := reg.Get(name); !ok && (ftag.Optional || ftag.HasDefault) {
+		if ftag.HasDefault {
+			if _, err := parseDefault(ftag.Default, field.Type); err != nil {
+				v.addf("%s's fixture %s has invalid default value: %v", caller, field.Name, err)
+			}
+		}
+		return
+	}
+	valType := v.fixture(reg, caller, scope, name, path)
+	if valType != nil && !valType.AssignableTo(field.Type) {
+		v.addf(
+			"%s's fixture %s has type %s, fixture '%s' returns %s",
+			caller, field.Name, field.Type, name, valType)
+	}
+}
+
+// fixture checks fixture registered under name and all its dependencies,
+// returns type of fixture value if the fixture is registered. path holds
+// fixtures depending on the fixture, it's used to detect dependency cycles.
+func (v *validator) fixture(
+	reg *Registry, caller string, callerScope FixtureScope, name string, path []string,
+) reflect.Type {
+	fentry, ok := reg.Get(name)
+	if !ok {
+		v.addf("Unregistered fixture found for caller %s: %s", caller, name)
+		return nil
+	}
+	if err := checkScopeDependency(caller, callerScope, name, fentry.Scope); err != nil {
+		v.problems = append(v.problems, err)
+	}
+	valType := fentry.valueType()
+
+	if cycle := dependencyCycle(path, name); cycle != nil {
+		v.addf("Fixture dependency cycle found for caller %s: %s",
+			caller, strings.Join(cycle, " -> "))
+		return valType
+	}
+
+	// ScopeCall fixtures take on scope of whoever requested them
+	depScope := fentry.Scope
+	if depScope == ScopeCall {
+		depScope = callerScope
+	}
+	checkedKey := fmt.Sprintf("%p/%s/%s", fentry.registry, name, depScope)
+	if v.checked[checkedKey] {
+		return valType
+	}
+	v.checked[checkedKey] = true
+
+	depCaller := fmt.Sprintf("fixture '%s'", name)
+	path = append(append([]string{}, path...), name)
+	v.fields(fentry.registry, depCaller, depScope, fentry.fixturesType(), path)
+	return valType
+}
+
+// dependencyCycle returns cycle formed by adding fixture name to dependency
+// path, e.g. [A B A], or nil if there is no cycle.
+func dependencyCycle(path []string, name string) []string {
+	for i, p := range path {
+		if p == name {
+			return append(append([]string{}, path[i:]...), name)
+		}
+	}
+	return nil
+}